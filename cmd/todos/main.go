@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/jaevor/go-nanoid"
@@ -19,6 +21,22 @@ func fromEnvFile() string {
 	return file
 }
 
+func fromEnvStore(dbFile string) (todos.Store, error) {
+	store, ok := os.LookupEnv("STORE")
+	if !ok {
+		store = "sqlite"
+	}
+
+	switch store {
+	case "sqlite":
+		return todos.NewDB(dbFile)
+	case "memory":
+		return todos.NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("invalid store: `%s`, try: [sqlite, memory]", store)
+	}
+}
+
 func fromEnvPort() string {
 	port, ok := os.LookupEnv("PORT")
 	if !ok {
@@ -27,6 +45,95 @@ func fromEnvPort() string {
 	return port
 }
 
+// fromEnvDuration reads a duration such as `30s` or `1h` from key, or returns
+// fallback if it is not set.
+func fromEnvDuration(key string, fallback time.Duration) (time.Duration, error) {
+	raw, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s: `%s`, use a positive duration like 30s or 1h", key, raw)
+	}
+	return d, nil
+}
+
+func fromEnvReminder(store todos.Store, slog *slog.Logger) (*todos.Reminder, error) {
+	interval, err := fromEnvDuration("REMINDER_INTERVAL", todos.DefaultReminderInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	window, err := fromEnvDuration("REMINDER_WINDOW", todos.DefaultReminderWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	return todos.NewReminder(&todos.ReminderConfig{
+		Store:      store,
+		Slog:       slog,
+		Interval:   interval,
+		Window:     window,
+		WebhookURL: os.Getenv("REMINDER_WEBHOOK_URL"),
+	}), nil
+}
+
+func fromEnvPurger(store todos.Store, slog *slog.Logger) (*todos.Purger, error) {
+	interval, err := fromEnvDuration("PURGE_INTERVAL", todos.DefaultPurgeInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	retention, err := fromEnvDuration("TRASH_RETENTION", todos.DefaultTrashRetention)
+	if err != nil {
+		return nil, err
+	}
+
+	return todos.NewPurger(&todos.PurgerConfig{
+		Store:     store,
+		Slog:      slog,
+		Interval:  interval,
+		Retention: retention,
+	}), nil
+}
+
+// fromEnvSnapshotter returns the Snapshotter writing to BACKUP_DIR, or nil if
+// it is not set.
+func fromEnvSnapshotter(store todos.Store, slog *slog.Logger) (*todos.Snapshotter, error) {
+	dir, ok := os.LookupEnv("BACKUP_DIR")
+	if !ok {
+		return nil, nil
+	}
+
+	backuper, ok := store.(todos.Backuper)
+	if !ok {
+		return nil, fmt.Errorf("invalid BACKUP_DIR: the store does not support backups")
+	}
+
+	interval, err := fromEnvDuration("BACKUP_INTERVAL", todos.DefaultSnapshotInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := todos.DefaultSnapshotKeep
+	if raw, ok := os.LookupEnv("BACKUP_KEEP"); ok {
+		keep, err = strconv.Atoi(raw)
+		if err != nil || keep <= 0 {
+			return nil, fmt.Errorf("invalid BACKUP_KEEP: `%s`, use a positive number", raw)
+		}
+	}
+
+	return todos.NewSnapshotter(&todos.SnapshotterConfig{
+		Store:    backuper,
+		Slog:     slog,
+		Dir:      dir,
+		Interval: interval,
+		Keep:     keep,
+	}), nil
+}
+
 func fromEnvSlog() (*slog.Logger, error) {
 	logLevel := slog.LevelInfo
 	if v, ok := os.LookupEnv("LOG_LEVEL"); ok {
@@ -47,6 +154,22 @@ func fromEnvSlog() (*slog.Logger, error) {
 	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})), nil
 }
 
+// restore replaces DB_FILE by the backup given as argument. The server must
+// not be running.
+func restore(args []string, dbFile string, slog *slog.Logger) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: todos restore <backup file>")
+	}
+
+	old, err := todos.RestoreBackup(context.Background(), args[0], dbFile)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("restored the database", "backup", args[0], "file", dbFile, "old", old)
+	return nil
+}
+
 func main() {
 	dbFile := fromEnvFile()
 	port := fromEnvPort()
@@ -55,15 +178,50 @@ func main() {
 		panic(err)
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "restore":
+			if err := restore(os.Args[2:], dbFile, slog); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "invalid command: `%s`, try: [restore]\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
+
+	store, err := fromEnvStore(dbFile)
+	if err != nil {
+		panic(err)
+	}
+
+	reminder, err := fromEnvReminder(store, slog)
+	if err != nil {
+		panic(err)
+	}
+
+	purger, err := fromEnvPurger(store, slog)
+	if err != nil {
+		panic(err)
+	}
+
+	snapshotter, err := fromEnvSnapshotter(store, slog)
+	if err != nil {
+		panic(err)
+	}
+
 	requestIDGenerator, err := nanoid.Canonic()
 	if err != nil {
 		panic(err)
 	}
 
 	todosHandler, err := todos.FromConfig(&todos.Config{
-		DBFile:             dbFile,
+		Store:              store,
 		Slog:               slog,
 		RequestIDGenerator: requestIDGenerator,
+		AdminToken:         os.Getenv("ADMIN_TOKEN"),
 	})
 	if err != nil {
 		panic(err)
@@ -75,6 +233,12 @@ func main() {
 		ReadHeaderTimeout: 5 * time.Second,
 	}
 
+	go reminder.Run(context.Background())
+	go purger.Run(context.Background())
+	if snapshotter != nil {
+		go snapshotter.Run(context.Background())
+	}
+
 	slog.Info("starting server", "port", port)
 	if err := server.ListenAndServe(); err != nil {
 		panic(err)
@@ -0,0 +1,322 @@
+package todos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultSnapshotInterval is how often a Snapshotter writes a snapshot
+	// when its config sets no interval.
+	DefaultSnapshotInterval = 24 * time.Hour
+	// DefaultSnapshotKeep is how many snapshots a Snapshotter keeps when its
+	// config sets no number.
+	DefaultSnapshotKeep = 7
+)
+
+// Snapshots are named after the time they were taken, so that they sort
+// oldest first.
+const (
+	snapshotPattern    = "todos-*.db"
+	snapshotTimeFormat = "20060102T150405.000000Z"
+)
+
+// Backuper is implemented by the stores that can write a consistent snapshot
+// of themselves while they keep serving requests.
+type Backuper interface {
+	// Backup writes a snapshot to file, which must not exist yet.
+	Backup(ctx context.Context, file string) error
+}
+
+// ErrInvalidBackup is returned when restoring a file that is not a backup of
+// a todos database this binary can open.
+type ErrInvalidBackup struct {
+	File   string
+	Reason string
+}
+
+func (e ErrInvalidBackup) Error() string {
+	return fmt.Sprintf("invalid backup `%s`: %s", e.File, e.Reason)
+}
+
+// Backup writes a snapshot of the database to file with `VACUUM INTO`, which
+// reads it in a single transaction and never sees a write half done.
+func (t *DB) Backup(ctx context.Context, file string) error {
+	_, err := t.db.ExecContext(ctx, "VACUUM INTO ?", file)
+	return err
+}
+
+// journalSuffixes are the suffixes of the files SQLite keeps next to a
+// database, which hold writes not yet in the database file itself.
+var journalSuffixes = []string{"-journal", "-wal"}
+
+// RestoreBackup replaces the database at dbFile by the backup, once the
+// backup passes validateBackup, and returns the name the replaced database
+// is kept under: dbFile with the time of the restore and an `.old` suffix,
+// so that every restore keeps its own. It returns the empty string if there
+// was no database to replace. No server may use dbFile while it is restored.
+func RestoreBackup(ctx context.Context, backup, dbFile string) (string, error) {
+	if err := validateBackup(ctx, backup); err != nil {
+		return "", err
+	}
+
+	if err := checkpoint(ctx, dbFile); err != nil {
+		return "", err
+	}
+
+	old := dbFile + "." + time.Now().UTC().Format(snapshotTimeFormat) + ".old"
+	if _, err := os.Stat(old); !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("failed to keep the replaced database: `%s` exists", old)
+	}
+
+	// Copy the backup next to dbFile first, so that the swap is a rename
+	// and dbFile is never left half written.
+	restored := dbFile + ".restore"
+	if err := copyFile(backup, restored); err != nil {
+		os.Remove(restored)
+		return "", err
+	}
+
+	if err := os.Rename(dbFile, old); errors.Is(err, os.ErrNotExist) {
+		old = ""
+	} else if err != nil {
+		os.Remove(restored)
+		return "", err
+	}
+
+	// The journals of the replaced database are empty once checkpointed,
+	// but would be applied to the backup when it is next opened.
+	for _, suffix := range []string{"-journal", "-wal", "-shm"} {
+		if err := os.Remove(dbFile + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return old, os.Rename(restored, dbFile)
+}
+
+// checkpoint writes the writes left in the journals of the database at
+// dbFile into the database file, and fails if any are left after, so that
+// none are lost when the file is replaced.
+func checkpoint(ctx context.Context, dbFile string) error {
+	if !hasJournal(dbFile) {
+		return nil
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+dbFile+"?mode=rw")
+	if err != nil {
+		return err
+	}
+	// Reading rolls back a transaction left half done in a journal.
+	var tables, busy, pages, checkpointed int
+	err = db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&tables)
+	if err == nil {
+		err = db.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &pages, &checkpointed)
+	}
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to checkpoint `%s`: %w", dbFile, err)
+	}
+
+	if busy != 0 || hasJournal(dbFile) {
+		return fmt.Errorf("failed to checkpoint `%s`: its journal is still in use, stop the server first", dbFile)
+	}
+	return nil
+}
+
+// hasJournal reports whether a journal of the database at dbFile holds
+// anything.
+func hasJournal(dbFile string) bool {
+	for _, suffix := range journalSuffixes {
+		if info, err := os.Stat(dbFile + suffix); err == nil && info.Size() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// validateBackup checks that backup is an intact SQLite database whose schema
+// was migrated by this binary, or by an older one that it can migrate.
+func validateBackup(ctx context.Context, backup string) error {
+	if _, err := os.Stat(backup); err != nil {
+		return err
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+backup+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var integrity string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return ErrInvalidBackup{File: backup, Reason: err.Error()}
+	}
+	if integrity != "ok" {
+		return ErrInvalidBackup{File: backup, Reason: integrity}
+	}
+
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version, name FROM schema_migrations ORDER BY version")
+	if err != nil {
+		return ErrInvalidBackup{File: backup, Reason: "no schema migrations"}
+	}
+	defer rows.Close()
+
+	applied := 0
+	for rows.Next() {
+		var version int
+		var name string
+		if err := rows.Scan(&version, &name); err != nil {
+			return err
+		}
+
+		if version > len(migrations) {
+			return ErrSchemaTooNew{Database: version, Binary: len(migrations)}
+		}
+		if m := migrations[applied]; version != m.version || name != m.name {
+			return ErrInvalidBackup{File: backup, Reason: fmt.Sprintf("unknown migration `%d_%s`", version, name)}
+		}
+		applied++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if applied == 0 {
+		return ErrInvalidBackup{File: backup, Reason: "no schema migrations"}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// SnapshotterConfig configures a Snapshotter.
+type SnapshotterConfig struct {
+	Store    Backuper
+	Slog     *slog.Logger
+	Dir      string
+	Interval time.Duration
+	Keep     int
+}
+
+// Snapshotter writes a snapshot of a store to its directory every interval,
+// and deletes the oldest snapshots beyond the number it keeps.
+type Snapshotter struct {
+	now      func() time.Time
+	store    Backuper
+	slog     *slog.Logger
+	dir      string
+	interval time.Duration
+	keep     int
+}
+
+func NewSnapshotter(c *SnapshotterConfig) *Snapshotter {
+	s := &Snapshotter{
+		now:      time.Now,
+		store:    c.Store,
+		slog:     c.Slog,
+		dir:      c.Dir,
+		interval: c.Interval,
+		keep:     c.Keep,
+	}
+	if s.interval <= 0 {
+		s.interval = DefaultSnapshotInterval
+	}
+	if s.keep <= 0 {
+		s.keep = DefaultSnapshotKeep
+	}
+	return s
+}
+
+// Run writes a snapshot every interval until ctx is done.
+func (s *Snapshotter) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.snapshot(ctx); err != nil {
+			s.slog.Error("failed to snapshot the database", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// snapshot writes a snapshot under a temporary name and renames it once it
+// is complete, so that the directory only ever holds whole snapshots.
+func (s *Snapshotter) snapshot(ctx context.Context) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return err
+	}
+
+	file := filepath.Join(s.dir, "todos-"+s.now().UTC().Format(snapshotTimeFormat)+".db")
+	tmp := file + ".tmp"
+	os.Remove(tmp)
+	if err := s.store.Backup(ctx, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return err
+	}
+	s.slog.Info("snapshot the database", "file", file)
+
+	return s.rotate()
+}
+
+// rotate deletes the oldest snapshots beyond the number to keep.
+func (s *Snapshotter) rotate() error {
+	snapshots, err := filepath.Glob(filepath.Join(s.dir, snapshotPattern))
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(snapshots)
+	for len(snapshots) > s.keep {
+		if err := os.Remove(snapshots[0]); err != nil {
+			return err
+		}
+		snapshots = snapshots[1:]
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package todos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	db, err := NewDB(filepath.Join(dir, "todos.db"))
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	if _, _, err := db.Upsert(ctx, Todo{ID: 1, Title: "Backed up"}, NoRevision); err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+
+	backup := filepath.Join(dir, "backup.db")
+	if err := db.Backup(ctx, backup); err != nil {
+		t.Fatalf("failed to back up: %v", err)
+	}
+	if _, _, err := db.Upsert(ctx, Todo{ID: 2, Title: "Not backed up"}, NoRevision); err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+	if err := db.Backup(ctx, backup); err == nil {
+		t.Fatalf("expected backing up over an existing file to fail")
+	}
+
+	restored := filepath.Join(dir, "restored.db")
+	if err := os.WriteFile(restored, []byte("replaced"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	old, err := RestoreBackup(ctx, backup, restored)
+	if err != nil {
+		t.Fatalf("failed to restore backup: %v", err)
+	}
+	if content, err := os.ReadFile(old); err != nil || string(content) != "replaced" {
+		t.Fatalf("expected the replaced file to be kept, got %q, %v", content, err)
+	}
+
+	// Every restore keeps the database it replaces.
+	again, err := RestoreBackup(ctx, backup, restored)
+	if err != nil {
+		t.Fatalf("failed to restore backup: %v", err)
+	}
+	olds, err := filepath.Glob(restored + ".*.old")
+	if err != nil || len(olds) != 2 || again == old {
+		t.Fatalf("expected 2 replaced databases kept, got %v, %v", olds, err)
+	}
+	if content, err := os.ReadFile(old); err != nil || string(content) != "replaced" {
+		t.Fatalf("expected the first replaced file to be kept, got %q, %v", content, err)
+	}
+
+	db, err = NewDB(restored)
+	if err != nil {
+		t.Fatalf("failed to open restored database: %v", err)
+	}
+	todos, err := db.List(ctx, ListOptions{Limit: MaxListLimit})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	if len(todos) != 1 || todos[0].Title != "Backed up" {
+		t.Fatalf("expected only the backed up todo, got %v", todos)
+	}
+}
+
+func TestRestoreBackupCheckpoints(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	backup := filepath.Join(dir, "backup.db")
+	if _, err := NewDB(backup); err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	// A database whose last write is only in its write-ahead log, as a
+	// server that crashed leaves it.
+	live := filepath.Join(dir, "live.db")
+	db, err := sql.Open("sqlite3", live+"?_journal_mode=WAL")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	db.SetMaxOpenConns(1)
+	for _, query := range []string{"PRAGMA wal_autocheckpoint = 0", "CREATE TABLE notes (id INTEGER PRIMARY KEY)", "INSERT INTO notes (id) VALUES (1)"} {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatalf("failed to exec %s: %v", query, err)
+		}
+	}
+	dbFile := filepath.Join(dir, "todos.db")
+	for _, suffix := range []string{"", "-wal"} {
+		content, err := os.ReadFile(live + suffix)
+		if err != nil {
+			t.Fatalf("failed to read file: %v", err)
+		}
+		if err := os.WriteFile(dbFile+suffix, content, 0o600); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	old, err := RestoreBackup(ctx, backup, dbFile)
+	if err != nil {
+		t.Fatalf("failed to restore backup: %v", err)
+	}
+	if _, err := os.Stat(dbFile + "-wal"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the write-ahead log to be removed, got %v", err)
+	}
+
+	oldDB := testSQLDB(t, testOpenFile(t, old))
+	var notes int
+	if err := oldDB.QueryRow("SELECT COUNT(*) FROM notes").Scan(&notes); err != nil || notes != 1 {
+		t.Fatalf("expected the logged note in the replaced database, got %d, %v", notes, err)
+	}
+}
+
+func TestRestoreBackupValidatesSchema(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "todos.db")
+
+	notSQLite := filepath.Join(dir, "not-sqlite.db")
+	if err := os.WriteFile(notSQLite, []byte("not a database"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := RestoreBackup(ctx, notSQLite, dbFile); !errors.As(err, new(ErrInvalidBackup)) {
+		t.Fatalf("expected ErrInvalidBackup, got %v", err)
+	}
+
+	otherSchema := filepath.Join(dir, "other-schema.db")
+	db := testSQLDB(t, testOpenFile(t, otherSchema))
+	if _, err := db.Exec("CREATE TABLE notes (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+	if _, err := RestoreBackup(ctx, otherSchema, dbFile); !errors.As(err, new(ErrInvalidBackup)) {
+		t.Fatalf("expected ErrInvalidBackup, got %v", err)
+	}
+
+	newerSchema := filepath.Join(dir, "newer-schema.db")
+	if _, err := NewDB(newerSchema); err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	db = testSQLDB(t, testOpenFile(t, newerSchema))
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (1000, 'future', '')"); err != nil {
+		t.Fatalf("failed to record future migration: %v", err)
+	}
+	if _, err := RestoreBackup(ctx, newerSchema, dbFile); !errors.As(err, new(ErrSchemaTooNew)) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+
+	if _, err := os.Stat(dbFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no database to be restored, got %v", err)
+	}
+}
+
+func TestSnapshotterRotates(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+
+	db, err := NewDB(filepath.Join(dir, "todos.db"))
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	snapshots := filepath.Join(dir, "snapshots")
+	snapshotter := NewSnapshotter(&SnapshotterConfig{
+		Store: db,
+		Slog:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Dir:   snapshots,
+		Keep:  2,
+	})
+	clock := &testClock{}
+	snapshotter.now = clock.Now
+
+	var want []string
+	for range 3 {
+		if err := snapshotter.snapshot(context.Background()); err != nil {
+			t.Fatalf("failed to snapshot: %v", err)
+		}
+		want = append(want, "todos-"+clock.Last().UTC().Format(snapshotTimeFormat)+".db")
+	}
+
+	entries, err := os.ReadDir(snapshots)
+	if err != nil {
+		t.Fatalf("failed to read snapshots: %v", err)
+	}
+	var got []string
+	for _, entry := range entries {
+		got = append(got, entry.Name())
+	}
+	if len(got) != 2 || got[0] != want[1] || got[1] != want[2] {
+		t.Fatalf("expected snapshots %v, got %v", want[1:], got)
+	}
+
+	if err := validateBackup(context.Background(), filepath.Join(snapshots, got[1])); err != nil {
+		t.Fatalf("expected a valid snapshot, got %v", err)
+	}
+}
+
+// testOpenFile opens file, creating it if needed, until the test ends.
+func testOpenFile(t *testing.T, file string) *os.File {
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
@@ -0,0 +1,71 @@
+package todos
+
+import "fmt"
+
+// MaxBatchOps is the largest number of operations a batch may hold.
+const MaxBatchOps = 1000
+
+// BatchOpKind is what a BatchOp does to its todo.
+type BatchOpKind string
+
+const (
+	// BatchPut creates or replaces a todo, like Upsert.
+	BatchPut BatchOpKind = "put"
+	// BatchPatch patches a todo, like Patch.
+	BatchPatch BatchOpKind = "patch"
+	// BatchDelete deletes a todo, like Delete.
+	BatchDelete BatchOpKind = "delete"
+)
+
+var batchOpKinds = []BatchOpKind{BatchPut, BatchPatch, BatchDelete}
+
+// ParseBatchOpKind returns the BatchOpKind named by raw.
+func ParseBatchOpKind(raw string) (BatchOpKind, error) {
+	for _, kind := range batchOpKinds {
+		if string(kind) == raw {
+			return kind, nil
+		}
+	}
+	return "", ErrInvalidBatchOp{Kind: BatchOpKind(raw)}
+}
+
+// BatchOp is one operation of a batch. Todo is what a put stores, Patch what a
+// patch applies and ID the todo a delete deletes. Revision is the revision the
+// todo is expected to be at, as for the single writes.
+type BatchOp struct {
+	Kind     BatchOpKind
+	Todo     Todo
+	Patch    TodoPatch
+	ID       int
+	Revision int
+}
+
+// BatchResult is the outcome of a BatchOp. Todo is the stored todo for puts
+// and patches, and Created reports whether a put created it.
+type BatchResult struct {
+	Todo    *Todo
+	Created bool
+}
+
+// ErrBatchOp is returned when the operation at Index fails a batch. None of
+// the operations of the batch are applied then.
+type ErrBatchOp struct {
+	Index int
+	Err   error
+}
+
+func (e ErrBatchOp) Error() string {
+	return fmt.Sprintf("op `%d`: %v", e.Index, e.Err)
+}
+
+func (e ErrBatchOp) Unwrap() error {
+	return e.Err
+}
+
+type ErrInvalidBatchOp struct {
+	Kind BatchOpKind
+}
+
+func (e ErrInvalidBatchOp) Error() string {
+	return fmt.Sprintf("invalid op: `%s`, try: [put, patch, delete]", e.Kind)
+}
@@ -0,0 +1,112 @@
+package todos
+
+import (
+	"cmp"
+	"container/heap"
+	"fmt"
+)
+
+// Dependency says that the todo TodoID is blocked by the todo BlockerID until
+// BlockerID is completed.
+type Dependency struct {
+	TodoID    int
+	BlockerID int
+}
+
+// ErrDependencyCycle is returned when a todo would end up blocked, directly or
+// not, by itself.
+type ErrDependencyCycle struct {
+	ID        int
+	BlockerID int
+}
+
+func (e ErrDependencyCycle) Error() string {
+	return fmt.Sprintf("todo `%d` cannot be blocked by todo `%d`, it would block itself", e.ID, e.BlockerID)
+}
+
+// ErrDependencyNotFound is returned when removing a blocker the todo does not
+// have.
+type ErrDependencyNotFound struct {
+	ID        int
+	BlockerID int
+}
+
+func (e ErrDependencyNotFound) Error() string {
+	return fmt.Sprintf("todo `%d` is not blocked by todo `%d`", e.ID, e.BlockerID)
+}
+
+// ErrOpenBlockers is returned when completing a todo whose blockers are not
+// all completed.
+type ErrOpenBlockers struct {
+	ID int
+}
+
+func (e ErrOpenBlockers) Error() string {
+	return fmt.Sprintf("todo `%d` is blocked by open todos, complete them first", e.ID)
+}
+
+// topologicalOrder orders the open todos so that every todo comes after the
+// open todos blocking it, and returns at most limit of them. The todos that
+// are actionable now come first. Among the todos whose blockers all come
+// earlier, the ones with the highest priority, then the lowest ID, go first.
+func topologicalOrder(todos []Todo, dependencies []Dependency, limit int) []Todo {
+	open := make(map[int]Todo)
+	for _, todo := range todos {
+		if !todo.Completed {
+			open[todo.ID] = todo
+		}
+	}
+
+	blocking := make(map[int][]int)
+	blockers := make(map[int]int)
+	for _, dependency := range dependencies {
+		_, todoOpen := open[dependency.TodoID]
+		_, blockerOpen := open[dependency.BlockerID]
+		if todoOpen && blockerOpen {
+			blocking[dependency.BlockerID] = append(blocking[dependency.BlockerID], dependency.TodoID)
+			blockers[dependency.TodoID]++
+		}
+	}
+
+	ready := &todoHeap{}
+	for id, todo := range open {
+		if blockers[id] == 0 {
+			heap.Push(ready, todo)
+		}
+	}
+
+	ordered := make([]Todo, 0, min(limit, len(open)))
+	for ready.Len() > 0 && len(ordered) < limit {
+		todo := heap.Pop(ready).(Todo)
+		ordered = append(ordered, todo)
+		for _, id := range blocking[todo.ID] {
+			if blockers[id]--; blockers[id] == 0 {
+				heap.Push(ready, open[id])
+			}
+		}
+	}
+	return ordered
+}
+
+// todoHeap pops the todo with the highest priority, then the lowest ID.
+type todoHeap []Todo
+
+func (h todoHeap) Len() int { return len(h) }
+
+func (h todoHeap) Less(i, j int) bool {
+	if c := cmp.Compare(h[i].Priority.rank(), h[j].Priority.rank()); c != 0 {
+		return c > 0
+	}
+	return h[i].ID < h[j].ID
+}
+
+func (h todoHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *todoHeap) Push(x any) { *h = append(*h, x.(Todo)) }
+
+func (h *todoHeap) Pop() any {
+	old := *h
+	todo := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return todo
+}
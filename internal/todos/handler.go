@@ -2,192 +2,1067 @@ package todos
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	headerContentType    = "Content-Type"
 	valueContentTypeJSON = "application/json"
 	headerXRequestID     = "X-Request-ID"
+	headerXUser          = "X-User"
+	headerLocation       = "Location"
+	headerIfNoneMatch    = "If-None-Match"
+	headerIfMatch        = "If-Match"
+	headerETag           = "ETag"
+	headerLink           = "Link"
+	headerAuthorization  = "Authorization"
+	headerAuthenticate   = "WWW-Authenticate"
+	headerDisposition    = "Content-Disposition"
+	valueContentTypeDB   = "application/vnd.sqlite3"
+	headerAcceptPatch    = "Accept-Patch"
+	// The media types of a JSON Merge Patch (RFC 7396) and of a JSON Patch
+	// (RFC 6902).
+	valueContentTypeMergePatch = "application/merge-patch+json"
+	valueContentTypeJSONPatch  = "application/json-patch+json"
 )
 
 type xRequestIDHeader string
 
 const xRequestIDHeaderKey xRequestIDHeader = headerXRequestID
 
+type xUserHeader string
+
+const xUserHeaderKey xUserHeader = headerXUser
+
+// anonymousUser is the caller of requests without an `X-User` header.
+const anonymousUser = "anonymous"
+
 type Handler struct {
-	Slog *slog.Logger
-	Mux  *http.ServeMux
-	db   *DB
+	Slog       *slog.Logger
+	Mux        *http.ServeMux
+	store      Store
+	adminToken string
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.Mux.ServeHTTP(w, r)
 }
 
+// Config configures a Handler. If Store is nil, a SQLite DB is opened at DBFile.
+// The admin endpoints answer 404 unless AdminToken is set.
 type Config struct {
 	DBFile             string
+	Store              Store
 	Slog               *slog.Logger
 	RequestIDGenerator func() string
+	AdminToken         string
 }
 
 func FromConfig(c *Config) (*Handler, error) {
-	db, err := NewDB(c.DBFile)
-	if err != nil {
-		return nil, err
+	store := c.Store
+	if store == nil {
+		db, err := NewDB(c.DBFile)
+		if err != nil {
+			return nil, err
+		}
+		store = db
 	}
 
-	h := &Handler{Slog: c.Slog, Mux: http.NewServeMux(), db: db}
+	h := &Handler{Slog: c.Slog, Mux: http.NewServeMux(), store: store, adminToken: c.AdminToken}
 
 	h.Mux.HandleFunc("GET /health", health)
 	h.Mux.HandleFunc("GET /todos", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.getAll))
+	h.Mux.HandleFunc("POST /todos", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.create))
 	h.Mux.HandleFunc("GET /todos/{id}", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.get))
 	h.Mux.HandleFunc("PUT /todos/{id}", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.insert))
 	h.Mux.HandleFunc("PATCH /todos/{id}", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.patch))
 	h.Mux.HandleFunc("DELETE /todos/{id}", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.delete))
+	h.Mux.HandleFunc("POST /todos/{id}", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.action))
+	h.Mux.HandleFunc("GET /todos/{id}/history", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.history))
+	h.Mux.HandleFunc("GET /todos/{id}/children", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.children))
+	h.Mux.HandleFunc("GET /todos/{id}/blockers", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.getBlockers))
+	h.Mux.HandleFunc("PUT /todos/{id}/blockers/{blockerID}", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.addBlocker))
+	h.Mux.HandleFunc("DELETE /todos/{id}/blockers/{blockerID}", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.removeBlocker))
+	h.Mux.HandleFunc("POST /todos:batch", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.batch))
+	h.Mux.HandleFunc("GET /todos:next", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.next))
+	h.Mux.HandleFunc("GET /trash", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.getTrash))
+	h.Mux.HandleFunc("GET /tags", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.getTags))
+	h.Mux.HandleFunc("GET /lists", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.getLists))
+	h.Mux.HandleFunc("POST /lists", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.createList))
+	h.Mux.HandleFunc("GET /lists/{listID}", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.getList))
+	h.Mux.HandleFunc("PUT /lists/{listID}", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.updateList))
+	h.Mux.HandleFunc("DELETE /lists/{listID}", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.deleteList))
+	h.Mux.HandleFunc("GET /admin/backup", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.withAdmin(h.backup)))
+	h.Mux.HandleFunc("GET /lists/{listID}/todos", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.getAll))
+	h.Mux.HandleFunc("POST /lists/{listID}/todos", withBaseMiddleware(c.Slog, c.RequestIDGenerator, h.create))
 	return h, nil
 }
 
 func health(_ http.ResponseWriter, _ *http.Request) {}
 
+// delete moves a todo to the trash, from where it can be restored until it
+// is purged. Todos in the trash answer 404 like todos that do not exist.
 func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
 	id, err := fromPathTodoID(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+		return
+	}
+
+	revision, err := fromHeaderIfMatch(r)
+	if err != nil {
+		h.writeIfMatchError(w, r, err)
+		return
+	}
+
+	if err := h.store.Delete(r.Context(), id, revision); err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+}
+
+// action runs the custom method in the path `/todos/{id}:{action}`. The only
+// action is `restore`, which takes the todo out of the trash.
+func (h *Handler) action(w http.ResponseWriter, r *http.Request) {
+	rawID, action, _ := strings.Cut(r.PathValue("id"), ":")
+	switch action {
+	case "restore":
+		r.SetPathValue("id", rawID)
+		h.restore(w, r)
+	default:
+		h.writeProblem(w, r, http.StatusNotFound, CodeRouteNotFound, fmt.Sprintf("invalid action: `%s`, try: [restore]", action))
+	}
+}
+
+// restore takes a todo out of the trash. A todo that is not in the trash
+// answers 409, as does a todo whose parent is still in the trash. With an
+// `If-Match` header the todo is only restored if its ETag matches.
+func (h *Handler) restore(w http.ResponseWriter, r *http.Request) {
+	id, err := fromPathTodoID(r)
+	if err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+		return
+	}
+
+	revision, err := fromHeaderIfMatch(r)
+	if err != nil {
+		h.writeIfMatchError(w, r, err)
+		return
+	}
+
+	restored, err := h.store.Restore(r.Context(), id, revision)
+	if err != nil {
+		h.writeStoreError(w, r, err)
 		return
 	}
 
-	if err := h.db.Delete(r.Context(), id); err != nil {
-		h.logError(r, http.StatusText(http.StatusInternalServerError), err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	w.Header().Set(headerETag, etag(restored))
+	h.writeJSON(w, r, http.StatusOK, restored)
+}
+
+// patch patches a todo with the kind of patch its Content-Type names: a JSON
+// Merge Patch with `application/merge-patch+json` or, as before,
+// `application/json`, and a JSON Patch with `application/json-patch+json`.
+// Other content types answer 400 with the accepted ones in `Accept-Patch`.
+//
+// With an `If-Match` header the todo is only patched if its ETag matches.
+func (h *Handler) patch(w http.ResponseWriter, r *http.Request) {
+	var apply func(w http.ResponseWriter, r *http.Request, id int)
+	switch contentType := r.Header.Get(headerContentType); contentType {
+	case valueContentTypeMergePatch, valueContentTypeJSON:
+		apply = h.mergePatch
+	case valueContentTypeJSONPatch:
+		apply = h.jsonPatch
+	default:
+		accepted := strings.Join([]string{valueContentTypeMergePatch, valueContentTypeJSONPatch, valueContentTypeJSON}, ", ")
+		w.Header().Set(headerAcceptPatch, accepted)
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidContentType, fmt.Sprintf("invalid header `%s` value: got `%s`, use one of %s", headerContentType, contentType, accepted))
 		return
 	}
+
+	id, err := fromPathTodoID(r)
+	if err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+		return
+	}
+
+	apply(w, r, id)
 }
 
-// patch handles patching a todo with a potentially partial JSON body.
+// mergePatch applies a JSON Merge Patch (RFC 7396) to the todo with the given
+// id.
 //
 // Example:
-// { id: 1, "title": "new title" } will only update the title.
-// { id: 1, "completed": true } will only update the completed field.
+// { "title": "new title" } will only update the title.
+// { "completed": true } will only update the completed field.
 //
-// id is required and must match the id in the path.
+// id may be left out, if set it must match the id in the path.
 //
-// If the Todo has a field set to null, it will be set to the empty value.
+// If the patch has a field set to null, it will be set to the empty value.
 //
 // Example:
-// { id: 1, "completed": null } will set completed to false.
-func (h *Handler) patch(w http.ResponseWriter, r *http.Request) {
-	if err := assertHeaderValueIs(r, headerContentType, valueContentTypeJSON); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+// { "completed": null } will set completed to false.
+func (h *Handler) mergePatch(w http.ResponseWriter, r *http.Request, id int) {
+	var v validator
+	patch := NewTodoPatch()
+	if err := decodeBody(w, r, &v, "patch", &patch); err != nil {
+		h.writeBodyError(w, r, err)
 		return
 	}
 
-	id, err := fromPathTodoID(r)
+	validateTodoPatch(&v, "", patch)
+	if patch.ID != 0 && patch.ID != id {
+		v.add("id", CodeMismatch, fmt.Sprintf("id in path `%d` and body `%d` do not match", id, patch.ID))
+	}
+	if err := v.err(); err != nil {
+		h.writeBodyError(w, r, err)
+		return
+	}
+	patch.ID = id
+
+	revision, err := fromHeaderIfMatch(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.writeIfMatchError(w, r, err)
 		return
 	}
 
-	patch := NewTodoPatch()
-	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	patched, err := h.store.Patch(r.Context(), patch, revision)
+	if err != nil {
+		h.writeStoreError(w, r, err)
 		return
 	}
 
-	if id != patch.ID {
-		http.Error(w, fmt.Sprintf("id in path `%d` and body `%d` do not match", id, patch.ID), http.StatusBadRequest)
+	w.Header().Set(headerETag, etag(patched))
+	h.writeJSON(w, r, http.StatusOK, patched)
+}
+
+// jsonPatch applies a JSON Patch (RFC 6902) to the todo with the given id. The
+// operations are applied in order to the todo as it is answered by GET, all of
+// them or, if one fails, none. The server managed fields and id may only be
+// tested.
+//
+// Example:
+// [{ "op": "test", "path": "/title", "value": "old title" }, { "op": "replace", "path": "/title", "value": "new title" }]
+// [{ "op": "add", "path": "/tags/-", "value": "urgent" }, { "op": "remove", "path": "/due_at" }]
+//
+// A failed test answers 409 and an operation that cannot be applied, such as
+// the removal of a missing value, answers 422.
+func (h *Handler) jsonPatch(w http.ResponseWriter, r *http.Request, id int) {
+	ops, err := fromBodyJSONPatch(w, r)
+	if err != nil {
+		h.writeBodyError(w, r, err)
+		return
+	}
+
+	revision, err := fromHeaderIfMatch(r)
+	if err != nil {
+		h.writeIfMatchError(w, r, err)
 		return
 	}
 
-	if err := h.db.Patch(r.Context(), patch); err != nil {
-		if errors.Is(err, ErrNoFieldsToUpdate) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+	patched, err := h.store.PatchFunc(r.Context(), id, revision, func(todo Todo) (TodoPatch, error) {
+		return applyJSONPatch(todo, ops)
+	})
+	if err != nil {
+		if errors.As(err, new(ErrInvalidFields)) {
+			h.writeBodyError(w, r, err)
+			return
+		}
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	w.Header().Set(headerETag, etag(patched))
+	h.writeJSON(w, r, http.StatusOK, patched)
+}
+
+// fromBodyJSONPatch decodes and validates the operations of a JSON Patch.
+// Every invalid operation is returned in ErrInvalidFields, pointing to its
+// index. As RFC 6902 asks, the members an operation does not define are
+// ignored.
+func fromBodyJSONPatch(w http.ResponseWriter, r *http.Request) ([]JSONPatchOp, error) {
+	var v validator
+	var ops []JSONPatchOp
+	if err := decodeBody(w, r, &v, "json patch", &ops); err != nil {
+		return nil, err
+	}
+
+	if len(ops) == 0 {
+		v.add("", CodeInvalid, "a JSON patch needs at least one op")
+	}
+	for i, op := range ops {
+		validateJSONPatchOp(&v, fmt.Sprintf("%d/", i), op)
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// create stores a new todo and lets the store assign its ID. The body must not
+// carry an id, use PUT /todos/{id} to choose one. Under /lists/{listID}/todos
+// the todo is created in that list.
+func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
+	if err := assertHeaderValueIs(r, headerContentType, valueContentTypeJSON); err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidContentType, err.Error())
+		return
+	}
+
+	var listID *int
+	if r.PathValue("listID") != "" {
+		id, err := fromPathListID(r)
+		if err != nil {
+			h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
 			return
 		}
+		listID = &id
+	}
 
-		h.logError(r, http.StatusText(http.StatusInternalServerError), err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	var v validator
+	todo := Todo{}
+	if err := decodeBody(w, r, &v, "todo", &todo); err != nil {
+		h.writeBodyError(w, r, err)
 		return
 	}
+
+	validateTodo(&v, "", todo)
+	if todo.ID != 0 {
+		v.add("id", CodeNotAllowed, fmt.Sprintf("id `%d` must not be set, it is assigned by the server", todo.ID))
+	}
+	if listID != nil && todo.ListID != nil && *todo.ListID != *listID {
+		v.add("list_id", CodeMismatch, fmt.Sprintf("list_id in path `%d` and body `%d` do not match", *listID, *todo.ListID))
+	}
+	if err := v.err(); err != nil {
+		h.writeBodyError(w, r, err)
+		return
+	}
+
+	if listID != nil {
+		if _, err := h.store.GetList(r.Context(), *listID); err != nil {
+			h.writeStoreError(w, r, err)
+			return
+		}
+		todo.ListID = listID
+	}
+
+	created, err := h.store.Create(r.Context(), todo)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	w.Header().Set(headerLocation, fmt.Sprintf("/todos/%d", created.ID))
+	w.Header().Set(headerETag, etag(created))
+	h.writeJSON(w, r, http.StatusCreated, created)
 }
 
+// insert creates the todo with the id in the path, or replaces it if it
+// exists. It answers 201 Created for new todos and 200 OK for replacements.
+//
+// `If-None-Match: *` refuses to replace an existing todo and `If-Match`
+// refuses to replace a todo whose ETag does not match, both with 412.
 func (h *Handler) insert(w http.ResponseWriter, r *http.Request) {
 	if err := assertHeaderValueIs(r, headerContentType, valueContentTypeJSON); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidContentType, err.Error())
 		return
 	}
 
 	id, err := fromPathTodoID(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
 		return
 	}
 
+	var v validator
 	todo := Todo{}
-	if err := json.NewDecoder(r.Body).Decode(&todo); err != nil {
-		http.Error(w, "failed to decode todo body", http.StatusBadRequest)
+	if err := decodeBody(w, r, &v, "todo", &todo); err != nil {
+		h.writeBodyError(w, r, err)
 		return
 	}
 
+	validateTodo(&v, "", todo)
 	if id != todo.ID {
-		http.Error(w, fmt.Sprintf("id in path `%d` and body `%d` do not match", id, todo.ID), http.StatusBadRequest)
+		v.add("id", CodeMismatch, fmt.Sprintf("id in path `%d` and body `%d` do not match", id, todo.ID))
+	}
+	if err := v.err(); err != nil {
+		h.writeBodyError(w, r, err)
+		return
+	}
+
+	revision, err := fromHeaderIfMatch(r)
+	if err != nil {
+		h.writeIfMatchError(w, r, err)
+		return
+	}
+
+	if r.Header.Get(headerIfNoneMatch) == "*" {
+		revision = NoRevision
+	}
+
+	stored, created, err := h.store.Upsert(r.Context(), todo, revision)
+	if err != nil {
+		var notFoundErr ErrNotFound
+		if errors.As(err, &notFoundErr) {
+			// If-Match never matches a todo that does not exist.
+			h.writeProblem(w, r, http.StatusPreconditionFailed, CodeRevisionMismatch, notFoundErr.Error())
+			return
+		}
+
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	w.Header().Set(headerETag, etag(stored))
+	if created {
+		w.Header().Set(headerLocation, fmt.Sprintf("/todos/%d", stored.ID))
+		h.writeJSON(w, r, http.StatusCreated, stored)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, stored)
+}
+
+// batchOp is an operation in the body of a batch. A put carries the todo to
+// store and a patch the patch to apply, both may leave out the id.
+type batchOp struct {
+	Op       string          `json:"op"`
+	ID       int             `json:"id"`
+	Revision int             `json:"revision"`
+	Todo     json.RawMessage `json:"todo"`
+	Patch    json.RawMessage `json:"patch"`
+}
+
+// batchResult is the outcome of an operation in the response of a batch.
+type batchResult struct {
+	Index  int       `json:"index"`
+	Status int       `json:"status"`
+	Todo   *Todo     `json:"todo,omitempty"`
+	Code   ErrorCode `json:"code,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	// Index is the operation that failed the batch, if any.
+	Index   *int          `json:"index,omitempty"`
+	Code    ErrorCode     `json:"code,omitempty"`
+	Error   string        `json:"error,omitempty"`
+	Results []batchResult `json:"results"`
+}
+
+// batch applies a list of put, patch and delete operations at once, all or
+// none of them.
+//
+// Example:
+// { "ops": [{ "op": "put", "id": 1, "todo": { "title": "new todo" } }] }
+// { "ops": [{ "op": "patch", "id": 2, "revision": 3, "patch": { "priority": "high" } }] }
+// { "ops": [{ "op": "delete", "id": 3 }] }
+//
+// `revision` does what `If-Match` does for the single writes. The response
+// holds a result per operation with the status code it would have answered
+// alone. If an operation fails, nothing is applied: the batch answers the
+// status of the failed operation with its index, and the other operations
+// answer 424 Failed Dependency.
+func (h *Handler) batch(w http.ResponseWriter, r *http.Request) {
+	if err := assertHeaderValueIs(r, headerContentType, valueContentTypeJSON); err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidContentType, err.Error())
+		return
+	}
+
+	ops, err := fromBodyBatch(w, r)
+	if err != nil {
+		h.writeBodyError(w, r, err)
 		return
 	}
 
-	if err := h.db.Insert(r.Context(), todo); err != nil {
-		h.logError(r, http.StatusText(http.StatusInternalServerError), err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	results, err := h.store.Batch(r.Context(), ops)
+	if err != nil {
+		var batchOpErr ErrBatchOp
+		if !errors.As(err, &batchOpErr) {
+			h.writeStoreError(w, r, err)
+			return
+		}
+
+		status, code := batchOpProblem(ops[batchOpErr.Index], batchOpErr.Err)
+		if status == http.StatusInternalServerError {
+			h.writeInternalError(w, r, err)
+			return
+		}
+
+		response := batchResponse{Index: &batchOpErr.Index, Code: code, Error: err.Error(), Results: make([]batchResult, len(ops))}
+		for i := range ops {
+			response.Results[i] = batchResult{Index: i, Status: http.StatusFailedDependency, Code: CodeNotApplied, Error: fmt.Sprintf("not applied, op `%d` failed", batchOpErr.Index)}
+		}
+		response.Results[batchOpErr.Index] = batchResult{Index: batchOpErr.Index, Status: status, Code: code, Error: batchOpErr.Err.Error()}
+		h.writeJSON(w, r, status, response)
 		return
 	}
+
+	response := batchResponse{Results: make([]batchResult, len(ops))}
+	for i, result := range results {
+		status := http.StatusOK
+		if result.Created {
+			status = http.StatusCreated
+		}
+		response.Results[i] = batchResult{Index: i, Status: status, Todo: result.Todo}
+	}
+	h.writeJSON(w, r, http.StatusOK, response)
+}
+
+// batchOpProblem returns the status code and error code answering err for
+// op, as the single write would have.
+func batchOpProblem(op BatchOp, err error) (int, ErrorCode) {
+	if op.Kind == BatchPut && errors.As(err, new(ErrNotFound)) {
+		// A revision never matches a todo that does not exist.
+		return http.StatusPreconditionFailed, CodeRevisionMismatch
+	}
+	return storeErrorProblem(err)
+}
+
+// fromBodyBatch decodes and validates the operations of a batch. Every invalid
+// operation and field is returned in ErrInvalidFields, pointing to its index.
+func fromBodyBatch(w http.ResponseWriter, r *http.Request) ([]BatchOp, error) {
+	var body struct {
+		Ops []json.RawMessage `json:"ops"`
+	}
+	var v validator
+	if err := decodeBody(w, r, &v, "batch", &body); err != nil {
+		return nil, err
+	}
+
+	if len(body.Ops) == 0 || len(body.Ops) > MaxBatchOps {
+		v.add("ops", CodeInvalid, fmt.Sprintf("invalid number of ops: `%d`, use between 1 and %d", len(body.Ops), MaxBatchOps))
+		return nil, v.err()
+	}
+
+	ops := make([]BatchOp, len(body.Ops))
+	for i, raw := range body.Ops {
+		prefix := fmt.Sprintf("ops/%d/", i)
+		var rawOp batchOp
+		if err := json.Unmarshal(raw, &rawOp); err != nil {
+			v.add(fmt.Sprintf("ops/%d", i), CodeInvalidBatchOp, err.Error())
+			continue
+		}
+		unknownFields(&v, prefix, raw, &rawOp)
+
+		op, err := fromBatchOp(&v, prefix, rawOp)
+		if err != nil {
+			v.add(fmt.Sprintf("ops/%d", i), CodeInvalidBatchOp, err.Error())
+			continue
+		}
+		ops[i] = op
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// fromBatchOp returns the operation rawOp, found at prefix in the body, or the
+// error that makes it invalid. The invalid fields of its todo or patch are
+// recorded in v.
+func fromBatchOp(v *validator, prefix string, rawOp batchOp) (BatchOp, error) {
+	kind, err := ParseBatchOpKind(rawOp.Op)
+	if err != nil {
+		return BatchOp{}, err
+	}
+
+	if rawOp.Revision < 0 {
+		return BatchOp{}, fmt.Errorf("invalid revision: `%d`", rawOp.Revision)
+	}
+
+	op := BatchOp{Kind: kind, ID: rawOp.ID, Revision: rawOp.Revision}
+	switch kind {
+	case BatchPut:
+		if rawOp.Todo == nil {
+			return BatchOp{}, errors.New("todo is required")
+		}
+		if err := decodeObject(v, prefix+"todo/", rawOp.Todo, &op.Todo); err != nil {
+			return BatchOp{}, errors.New("failed to decode todo")
+		}
+		validateTodo(v, prefix+"todo/", op.Todo)
+		op.ID, err = batchOpID(op.ID, op.Todo.ID)
+		op.Todo.ID = op.ID
+	case BatchPatch:
+		if rawOp.Patch == nil {
+			return BatchOp{}, errors.New("patch is required")
+		}
+		op.Patch = NewTodoPatch()
+		if err := decodeObject(v, prefix+"patch/", rawOp.Patch, &op.Patch); err != nil {
+			return BatchOp{}, err
+		}
+		validateTodoPatch(v, prefix+"patch/", op.Patch)
+		op.ID, err = batchOpID(op.ID, op.Patch.ID)
+		op.Patch.ID = op.ID
+	case BatchDelete:
+		op.ID, err = batchOpID(op.ID, 0)
+	}
+	return op, err
+}
+
+// batchOpID returns the id of an operation, set on the operation, in its body
+// or in both if they match.
+func batchOpID(id, bodyID int) (int, error) {
+	switch {
+	case id < 0 || bodyID < 0:
+		return 0, fmt.Errorf("invalid id: `%d`", min(id, bodyID))
+	case id == 0 && bodyID == 0:
+		return 0, errors.New("id is required")
+	case id == 0:
+		return bodyID, nil
+	case bodyID != 0 && bodyID != id:
+		return 0, fmt.Errorf("id `%d` and body id `%d` do not match", id, bodyID)
+	default:
+		return id, nil
+	}
 }
 
+// getAll lists todos one page at a time. `limit` sets the page size and
+// `cursor` continues after a previous page. When more todos follow, the `Link`
+// header points to the next page.
+//
+// Todos can be filtered with `completed=true|false`, `overdue=true|false`,
+// `blocked=true|false`, blocked by an open todo, and `q=`, a case insensitive
+// substring of the title or description, and ordered
+// with `sort=id|-id|title|-title|priority|-priority`. Repeated `tag=` keep the
+// todos with any of the tags, or all of them with `tag_match=all`.
+// `created_after`, `created_before`, `updated_after`, `updated_before`,
+// `completed_after`, `completed_before`, `due_after` and `due_before` take
+// RFC 3339 times, `after` bounds are inclusive and `before` bounds are
+// exclusive. Unknown parameters are rejected.
+//
+// Under /lists/{listID}/todos only the todos in that list are listed, and
+// under /todos/{id}/children only the children of that todo.
+//
+// Todos are answered in the format the `Accept` header prefers: JSON, CSV,
+// YAML, NDJSON, or a checklist like `- [x] title` as plain text or Markdown.
+// Other formats answer 406.
 func (h *Handler) getAll(w http.ResponseWriter, r *http.Request) {
-	todos, err := h.db.GetAll(r.Context())
+	h.list(w, r, false)
+}
+
+// getTrash lists the todos in the trash like getAll lists the others.
+func (h *Handler) getTrash(w http.ResponseWriter, r *http.Request) {
+	h.list(w, r, true)
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request, trashed bool) {
+	mediaType, ok := h.negotiate(w, r, todoMediaTypes)
+	if !ok {
+		return
+	}
+
+	opts, err := fromQueryListOptions(r)
+	if err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, err.Error())
+		return
+	}
+	opts.Trashed = trashed
+
+	if r.PathValue("listID") != "" {
+		listID, err := fromPathListID(r)
+		if err != nil {
+			h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+			return
+		}
+
+		if _, err := h.store.GetList(r.Context(), listID); err != nil {
+			h.writeStoreError(w, r, err)
+			return
+		}
+		opts.ListID = &listID
+	}
+
+	if r.PathValue("id") != "" {
+		id, err := fromPathTodoID(r)
+		if err != nil {
+			h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+			return
+		}
+
+		if _, err := h.store.Get(r.Context(), id); err != nil {
+			h.writeStoreError(w, r, err)
+			return
+		}
+		opts.ParentID = &id
+	}
+
+	// Ask for one more todo than the page holds to know if there is a next page.
+	limit := opts.Limit
+	opts.Limit++
+	todos, err := h.store.List(r.Context(), opts)
 	if err != nil {
-		h.logError(r, http.StatusText(http.StatusInternalServerError), err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		h.writeInternalError(w, r, err)
 		return
 	}
 
-	h.writeJSON(w, r, todos)
+	if len(todos) > limit {
+		todos = todos[:limit]
+		w.Header().Set(headerLink, nextPageLink(r, CursorOf(opts.Sort, todos[limit-1])))
+	}
+
+	h.writeTodos(w, r, mediaType, todos, false)
 }
 
-func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+// children lists the children of a todo like getAll does. With `tree=true`
+// it answers the todo with all its descendants nested under it instead, in a
+// single response.
+func (h *Handler) children(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	switch rawTree := query.Get("tree"); rawTree {
+	case "", "false":
+		query.Del("tree")
+		r.URL.RawQuery = query.Encode()
+		h.getAll(w, r)
+		return
+	case "true":
+	default:
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, fmt.Sprintf("invalid tree: `%s`, try: [true, false]", rawTree))
+		return
+	}
+
+	if len(query) > 1 {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, "tree does not take other query parameters")
+		return
+	}
+
 	id, err := fromPathTodoID(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
 		return
 	}
 
-	todo, err := h.db.Get(r.Context(), id)
+	todo, err := h.store.Get(r.Context(), id)
 	if err != nil {
-		var notFoundErr ErrNotFound
-		if errors.As(err, &notFoundErr) {
-			http.Error(w, notFoundErr.Error(), http.StatusNotFound)
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	descendants, err := h.store.Descendants(r.Context(), id)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, newTodoTree(*todo, descendants))
+}
+
+// history responds with every change of the todo, oldest first. The history
+// outlives the todo, it is still served once the todo is purged.
+func (h *Handler) history(w http.ResponseWriter, r *http.Request) {
+	id, err := fromPathTodoID(r)
+	if err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+		return
+	}
+
+	entries, err := h.store.History(r.Context(), id)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, entries)
+}
+
+func (h *Handler) getBlockers(w http.ResponseWriter, r *http.Request) {
+	id, err := fromPathTodoID(r)
+	if err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+		return
+	}
+
+	blockers, err := h.store.Blockers(r.Context(), id)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, blockers)
+}
+
+// addBlocker makes the todo blocked by the todo blockerID. Adding a blocker
+// twice is a no-op, and a blocker that would make the todo block itself is
+// refused with 422.
+func (h *Handler) addBlocker(w http.ResponseWriter, r *http.Request) {
+	id, blockerID, err := fromPathDependency(r)
+	if err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+		return
+	}
+
+	if err := h.store.AddBlocker(r.Context(), id, blockerID); err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+}
+
+func (h *Handler) removeBlocker(w http.ResponseWriter, r *http.Request) {
+	id, blockerID, err := fromPathDependency(r)
+	if err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+		return
+	}
+
+	if err := h.store.RemoveBlocker(r.Context(), id, blockerID); err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+}
+
+// next lists the open todos in an order they can be done in: every todo comes
+// after the open todos blocking it, so the first ones are actionable now.
+// Among todos ready at the same time the highest priority goes first. `limit`
+// sets how many todos to answer.
+func (h *Handler) next(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	for key := range query {
+		if key != "limit" {
+			h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, fmt.Sprintf("invalid query parameter: `%s`, try: [limit]", key))
+			return
+		}
+	}
+
+	limit := DefaultListLimit
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		var err error
+		limit, err = strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > MaxListLimit {
+			h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, fmt.Sprintf("invalid limit: `%s`, use a number between 1 and %d", rawLimit, MaxListLimit))
 			return
 		}
+	}
+
+	todos, err := h.store.Next(r.Context(), limit)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, todos)
+}
+
+func (h *Handler) getLists(w http.ResponseWriter, r *http.Request) {
+	lists, err := h.store.GetLists(r.Context())
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, lists)
+}
+
+// createList stores a new list and lets the store assign its ID.
+func (h *Handler) createList(w http.ResponseWriter, r *http.Request) {
+	if err := assertHeaderValueIs(r, headerContentType, valueContentTypeJSON); err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidContentType, err.Error())
+		return
+	}
+
+	list, err := fromBodyList(w, r, 0)
+	if err != nil {
+		h.writeBodyError(w, r, err)
+		return
+	}
+
+	created, err := h.store.CreateList(r.Context(), list)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	w.Header().Set(headerLocation, fmt.Sprintf("/lists/%d", created.ID))
+	h.writeJSON(w, r, http.StatusCreated, created)
+}
+
+func (h *Handler) getList(w http.ResponseWriter, r *http.Request) {
+	id, err := fromPathListID(r)
+	if err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+		return
+	}
+
+	list, err := h.store.GetList(r.Context(), id)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, list)
+}
+
+// updateList renames an existing list.
+func (h *Handler) updateList(w http.ResponseWriter, r *http.Request) {
+	if err := assertHeaderValueIs(r, headerContentType, valueContentTypeJSON); err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidContentType, err.Error())
+		return
+	}
+
+	id, err := fromPathListID(r)
+	if err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+		return
+	}
+
+	list, err := fromBodyList(w, r, id)
+	if err != nil {
+		h.writeBodyError(w, r, err)
+		return
+	}
+
+	updated, err := h.store.UpdateList(r.Context(), list)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, updated)
+}
+
+// deleteList deletes an empty list. A list that still has todos is only
+// deleted, together with its todos, with `cascade=true`, and answers 409
+// Conflict otherwise.
+func (h *Handler) deleteList(w http.ResponseWriter, r *http.Request) {
+	id, err := fromPathListID(r)
+	if err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+		return
+	}
+
+	var cascade bool
+	switch rawCascade := r.URL.Query().Get("cascade"); rawCascade {
+	case "", "false":
+	case "true":
+		cascade = true
+	default:
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidQuery, fmt.Sprintf("invalid cascade: `%s`, try: [true, false]", rawCascade))
+		return
+	}
+
+	if err := h.store.DeleteList(r.Context(), id, cascade); err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+}
+
+// fromBodyList decodes and validates a list. id is the id in the path, or 0
+// when the list is created and its id is assigned by the server.
+func fromBodyList(w http.ResponseWriter, r *http.Request, id int) (List, error) {
+	var v validator
+	var list List
+	if err := decodeBody(w, r, &v, "list", &list); err != nil {
+		return List{}, err
+	}
+
+	validateList(&v, list)
+	switch {
+	case id == 0 && list.ID != 0:
+		v.add("id", CodeNotAllowed, fmt.Sprintf("id `%d` must not be set, it is assigned by the server", list.ID))
+	case id != 0 && list.ID != 0 && list.ID != id:
+		v.add("id", CodeMismatch, fmt.Sprintf("id in path `%d` and body `%d` do not match", id, list.ID))
+	}
+	if err := v.err(); err != nil {
+		return List{}, err
+	}
+
+	list.ID = id
+	return list, nil
+}
+
+// backup responds with a consistent snapshot of the database, taken while
+// the store keeps serving requests. Stores that cannot back up answer 501.
+func (h *Handler) backup(w http.ResponseWriter, r *http.Request) {
+	backuper, ok := h.store.(Backuper)
+	if !ok {
+		h.writeProblem(w, r, http.StatusNotImplemented, CodeNotImplemented, "the store does not support backups")
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "todos-backup-")
+	if err != nil {
+		h.writeInternalError(w, r, err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "todos.db")
+	if err := backuper.Backup(r.Context(), file); err != nil {
+		h.writeInternalError(w, r, err)
+		return
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		h.writeInternalError(w, r, err)
+		return
+	}
+	defer f.Close()
 
-		h.logError(r, http.StatusText(http.StatusInternalServerError), err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	now := time.Now().UTC()
+	w.Header().Set(headerContentType, valueContentTypeDB)
+	w.Header().Set(headerDisposition, fmt.Sprintf(`attachment; filename="todos-%s.db"`, now.Format(snapshotTimeFormat)))
+	http.ServeContent(w, r, "", now, f)
+}
+
+// getTags lists the tags in use with the number of todos tagged with each.
+func (h *Handler) getTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := h.store.Tags(r.Context())
+	if err != nil {
+		h.writeInternalError(w, r, err)
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, tags)
+}
+
+// get answers a todo in the format the `Accept` header asks for, like getAll.
+func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := h.negotiate(w, r, todoMediaTypes)
+	if !ok {
+		return
+	}
+
+	id, err := fromPathTodoID(r)
+	if err != nil {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidPath, err.Error())
+		return
+	}
+
+	todo, err := h.store.Get(r.Context(), id)
+	if err != nil {
+		h.writeStoreError(w, r, err)
+		return
+	}
+
+	tag := representationETag(todo, mediaType)
+	w.Header().Set(headerETag, tag)
+	if matchesIfNoneMatch(r, tag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	h.writeJSON(w, r, todo)
+	h.writeTodos(w, r, mediaType, []Todo{*todo}, true)
 }
 
-func (h *Handler) writeJSON(w http.ResponseWriter, r *http.Request, data any) {
+func (h *Handler) writeJSON(w http.ResponseWriter, r *http.Request, status int, data any) {
 	w.Header().Set(headerContentType, valueContentTypeJSON)
 	w.Header().Set(headerXRequestID, fromContext(r, xRequestIDHeaderKey))
+	w.WriteHeader(status)
 
+	// The status is already sent, the error can only be logged.
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		h.logError(r, http.StatusText(http.StatusInternalServerError), err)
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return
+		h.logError(r, "failed to write response", err)
 	}
 }
 
@@ -207,6 +1082,39 @@ func withRequestID(requestIDGenerator func() string, next http.HandlerFunc) http
 	}
 }
 
+// withAdmin lets through the requests carrying the admin token as a bearer
+// token. Without an admin token configured, admin endpoints do not exist.
+func (h *Handler) withAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.adminToken == "" {
+			h.writeProblem(w, r, http.StatusNotFound, CodeRouteNotFound, "admin endpoints are disabled")
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get(headerAuthorization), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+			w.Header().Set(headerAuthenticate, "Bearer")
+			h.writeProblem(w, r, http.StatusUnauthorized, CodeUnauthorized, "admin token required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// withUser puts the identity of the caller, taken from the `X-User` header, in
+// the context. It is recorded in the history of the todos the request changes.
+func withUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := r.Header.Get(headerXUser)
+		if user == "" {
+			user = anonymousUser
+		}
+		ctx := context.WithValue(r.Context(), xUserHeaderKey, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
 func withLoggingMethod(slog *slog.Logger, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		slog.Info("", "method", r.Method, "path", r.URL.Path, "requestID", fromContext(r, xRequestIDHeaderKey))
@@ -215,7 +1123,7 @@ func withLoggingMethod(slog *slog.Logger, next http.HandlerFunc) http.HandlerFun
 }
 
 func withBaseMiddleware(slog *slog.Logger, requestIDGenerator func() string, next http.HandlerFunc) http.HandlerFunc {
-	return withRequestID(requestIDGenerator, withLoggingMethod(slog, next))
+	return withRequestID(requestIDGenerator, withUser(withLoggingMethod(slog, next)))
 }
 
 func assertHeaderValueIs(r *http.Request, header string, value string) error {
@@ -225,11 +1133,239 @@ func assertHeaderValueIs(r *http.Request, header string, value string) error {
 	return nil
 }
 
+var listQueryParameters = []string{
+	"limit", "cursor", "completed", "overdue", "blocked", "tag", "tag_match", "q", "sort",
+	"created_after", "created_before", "updated_after", "updated_before", "completed_after", "completed_before",
+	"due_after", "due_before",
+}
+
+func fromQueryListOptions(r *http.Request) (ListOptions, error) {
+	query := r.URL.Query()
+	for key := range query {
+		if !slices.Contains(listQueryParameters, key) {
+			return ListOptions{}, fmt.Errorf("invalid query parameter: `%s`, try: %v", key, listQueryParameters)
+		}
+	}
+
+	opts := ListOptions{Limit: DefaultListLimit, Query: query.Get("q")}
+
+	if rawLimit := query.Get("limit"); rawLimit != "" {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > MaxListLimit {
+			return ListOptions{}, fmt.Errorf("invalid limit: `%s`, use a number between 1 and %d", rawLimit, MaxListLimit)
+		}
+		opts.Limit = limit
+	}
+
+	if rawCompleted := query.Get("completed"); rawCompleted != "" {
+		switch rawCompleted {
+		case "true", "false":
+			completed := rawCompleted == "true"
+			opts.Completed = &completed
+		default:
+			return ListOptions{}, fmt.Errorf("invalid completed: `%s`, try: [true, false]", rawCompleted)
+		}
+	}
+
+	opts.Tags = normalizeTags(query["tag"])
+	if rawTagMatch := query.Get("tag_match"); rawTagMatch != "" {
+		switch rawTagMatch {
+		case "any", "all":
+			opts.AllTags = rawTagMatch == "all"
+		default:
+			return ListOptions{}, fmt.Errorf("invalid tag_match: `%s`, try: [any, all]", rawTagMatch)
+		}
+	}
+
+	if rawBlocked := query.Get("blocked"); rawBlocked != "" {
+		switch rawBlocked {
+		case "true", "false":
+			blocked := rawBlocked == "true"
+			opts.Blocked = &blocked
+		default:
+			return ListOptions{}, fmt.Errorf("invalid blocked: `%s`, try: [true, false]", rawBlocked)
+		}
+	}
+
+	if rawOverdue := query.Get("overdue"); rawOverdue != "" {
+		switch rawOverdue {
+		case "true", "false":
+			overdue := rawOverdue == "true"
+			opts.Overdue = &overdue
+		default:
+			return ListOptions{}, fmt.Errorf("invalid overdue: `%s`, try: [true, false]", rawOverdue)
+		}
+	}
+
+	timeRanges := []struct {
+		name      string
+		timeRange *TimeRange
+	}{
+		{"created", &opts.CreatedAt},
+		{"updated", &opts.UpdatedAt},
+		{"completed", &opts.CompletedAt},
+		{"due", &opts.DueAt},
+	}
+	for _, tr := range timeRanges {
+		var err error
+		if tr.timeRange.After, err = fromQueryTime(query, tr.name+"_after"); err != nil {
+			return ListOptions{}, err
+		}
+		if tr.timeRange.Before, err = fromQueryTime(query, tr.name+"_before"); err != nil {
+			return ListOptions{}, err
+		}
+	}
+
+	if rawSort := query.Get("sort"); rawSort != "" {
+		sort, err := ParseSort(rawSort)
+		if err != nil {
+			return ListOptions{}, err
+		}
+		opts.Sort = sort
+	}
+
+	if rawCursor := query.Get("cursor"); rawCursor != "" {
+		cursor, err := DecodeCursor(rawCursor)
+		if err != nil || cursor.Sort != opts.Sort.String() {
+			return ListOptions{}, fmt.Errorf("invalid cursor: `%s`", rawCursor)
+		}
+		opts.After = cursor
+	}
+
+	return opts, nil
+}
+
+// fromQueryTime parses the RFC 3339 time in the query parameter key, if set.
+func fromQueryTime(query url.Values, key string) (*time.Time, error) {
+	raw := query.Get(key)
+	if raw == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: `%s`, use an RFC 3339 time", key, raw)
+	}
+	return &t, nil
+}
+
+// nextPageLink returns a `Link` header value pointing to the page after
+// cursor, keeping every other query parameter of r.
+func nextPageLink(r *http.Request, cursor *Cursor) string {
+	query := r.URL.Query()
+	query.Set("cursor", cursor.Encode())
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf(`<%s>; rel="next"`, next.String())
+}
+
 func fromPathTodoID(r *http.Request) (int, error) {
 	rawID := r.PathValue("id")
 	id, err := strconv.Atoi(rawID)
-	if err != nil {
+	if err != nil || id < 1 {
 		return 0, fmt.Errorf("invalid id: `%s`", rawID)
 	}
 	return id, nil
 }
+
+func fromPathListID(r *http.Request) (int, error) {
+	rawID := r.PathValue("listID")
+	id, err := strconv.Atoi(rawID)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid list id: `%s`", rawID)
+	}
+	return id, nil
+}
+
+// fromPathDependency returns the todo and blocker IDs in the path.
+func fromPathDependency(r *http.Request) (int, int, error) {
+	id, err := fromPathTodoID(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	rawBlockerID := r.PathValue("blockerID")
+	blockerID, err := strconv.Atoi(rawBlockerID)
+	if err != nil || blockerID < 1 {
+		return 0, 0, fmt.Errorf("invalid blocker id: `%s`", rawBlockerID)
+	}
+	return id, blockerID, nil
+}
+
+// etag returns the strong entity tag of the JSON representation of todo,
+// derived from its revision.
+func etag(todo *Todo) string {
+	return fmt.Sprintf(`"%d"`, todo.Revision)
+}
+
+// representationETag returns the entity tag of todo in mediaType, one of
+// todoMediaTypes. The representations other than JSON are told apart by the
+// subtype of their media type, like `"2-csv"`, so that a conditional GET of
+// one does not validate another.
+func representationETag(todo *Todo, mediaType string) string {
+	if mediaType == valueContentTypeJSON {
+		return etag(todo)
+	}
+	_, subtype, _ := strings.Cut(mediaType, "/")
+	return fmt.Sprintf(`"%d-%s"`, todo.Revision, subtype)
+}
+
+// ErrWeakIfMatch is returned for an `If-Match` header holding a weak ETag,
+// which never matches as `If-Match` compares ETags strongly.
+type ErrWeakIfMatch struct {
+	Value string
+}
+
+func (e ErrWeakIfMatch) Error() string {
+	return fmt.Sprintf("header `%s` value `%s` is a weak ETag, which never matches", headerIfMatch, e.Value)
+}
+
+// fromHeaderIfMatch returns the revision required by the `If-Match` header,
+// or AnyRevision if there is none. Only a single ETag or `*` is supported,
+// the ETag of any representation of the todo. A weak ETag fails with
+// ErrWeakIfMatch.
+func fromHeaderIfMatch(r *http.Request) (int, error) {
+	value := r.Header.Get(headerIfMatch)
+	if value == "" || value == "*" {
+		return AnyRevision, nil
+	}
+	if strings.HasPrefix(value, "W/") {
+		return 0, ErrWeakIfMatch{Value: value}
+	}
+
+	rawRevision, ok := strings.CutPrefix(value, `"`)
+	if ok {
+		rawRevision, ok = strings.CutSuffix(rawRevision, `"`)
+	}
+	for _, mediaType := range todoMediaTypes[1:] {
+		_, subtype, _ := strings.Cut(mediaType, "/")
+		if trimmed, found := strings.CutSuffix(rawRevision, "-"+subtype); found {
+			rawRevision = trimmed
+			break
+		}
+	}
+	revision, err := strconv.Atoi(rawRevision)
+	if !ok || err != nil || revision < 1 {
+		return 0, fmt.Errorf("invalid header `%s` value: `%s`", headerIfMatch, value)
+	}
+	return revision, nil
+}
+
+// matchesIfNoneMatch reports whether the `If-None-Match` header matches tag,
+// using the weak comparison that applies to conditional GET requests.
+func matchesIfNoneMatch(r *http.Request, tag string) bool {
+	value := r.Header.Get(headerIfNoneMatch)
+	if value == "" {
+		return false
+	}
+	if strings.TrimSpace(value) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(value, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -3,20 +3,24 @@ package todos
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
+	"slices"
 	"strings"
 	"testing"
 	"time"
 )
 
-func testHandler(t *testing.T, tempFile *os.File) *Handler {
+func testHandler(t *testing.T) *Handler {
 	handler, err := FromConfig(&Config{
-		DBFile: tempFile.Name(),
-		Slog:   slog.New(slog.NewJSONHandler(os.Stdout, nil)),
+		Store: NewMemoryStore(),
+		Slog:  slog.New(slog.NewJSONHandler(os.Stdout, nil)),
 		RequestIDGenerator: func() string {
 			return "123"
 		},
@@ -27,20 +31,27 @@ func testHandler(t *testing.T, tempFile *os.File) *Handler {
 	return handler
 }
 
-func testTempFile(t *testing.T) *os.File {
-	name := fmt.Sprintf("test-%d.db", time.Now().UnixNano())
-	tempFile, err := os.CreateTemp("", name)
+// testServe sends a request with a JSON body, if any, to handler.
+func testServe(t *testing.T, handler *Handler, method, path, body string, header http.Header) *httptest.ResponseRecorder {
+	r, err := http.NewRequestWithContext(context.Background(), method, path, strings.NewReader(body))
 	if err != nil {
-		t.Fatalf("failed to create temp file: %v", err)
+		t.Fatalf("failed to create request: %v", err)
+	}
+	for key, values := range header {
+		r.Header[key] = values
 	}
-	return tempFile
+	if body != "" && r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	w := httptest.NewRecorder()
+	handler.Mux.ServeHTTP(w, r)
+	return w
 }
 
 func TestTodosHandlerFailure(t *testing.T) {
 	t.Parallel()
-	tempFile := testTempFile(t)
-	defer os.Remove(tempFile.Name())
-	handler := testHandler(t, tempFile)
+	handler := testHandler(t)
 
 	r, err := http.NewRequestWithContext(context.Background(), http.MethodDelete, "/todos/1", nil)
 	if err != nil {
@@ -50,8 +61,8 @@ func TestTodosHandlerFailure(t *testing.T) {
 	w := httptest.NewRecorder()
 	handler.Mux.ServeHTTP(w, r)
 
-	if w.Code != http.StatusOK {
-		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status code %d, got %d", http.StatusNotFound, w.Code)
 	}
 
 	r, err = http.NewRequestWithContext(context.Background(), http.MethodGet, "/todos/1", nil)
@@ -91,9 +102,7 @@ func TestTodosHandlerFailure(t *testing.T) {
 
 func TestContentType(t *testing.T) {
 	t.Parallel()
-	tempFile := testTempFile(t)
-	defer os.Remove(tempFile.Name())
-	handler := testHandler(t, tempFile)
+	handler := testHandler(t)
 
 	r, err := http.NewRequestWithContext(context.Background(), http.MethodPut, "/todos/1", strings.NewReader(`{"id": 1,  "description": "test","title": "test", "completed": false}`))
 	if err != nil {
@@ -116,16 +125,14 @@ func TestContentType(t *testing.T) {
 	w = httptest.NewRecorder()
 	handler.Mux.ServeHTTP(w, r)
 
-	if w.Code != http.StatusOK {
-		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
 	}
 }
 
 func TestPatchWithNulls(t *testing.T) {
 	t.Parallel()
-	tempFile := testTempFile(t)
-	defer os.Remove(tempFile.Name())
-	handler := testHandler(t, tempFile)
+	handler := testHandler(t)
 
 	r, err := http.NewRequestWithContext(context.Background(), http.MethodPut, "/todos/1", strings.NewReader(`{"id": 1,  "description": "test","title": "test", "completed": false}`))
 	if err != nil {
@@ -136,8 +143,8 @@ func TestPatchWithNulls(t *testing.T) {
 	w := httptest.NewRecorder()
 	handler.Mux.ServeHTTP(w, r)
 
-	if w.Code != http.StatusOK {
-		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
 	}
 
 	// we setting descrption to null, we expect it to be set to the empty value
@@ -193,9 +200,7 @@ func TestPatchWithNulls(t *testing.T) {
 
 func TestPatchNoFieldsToUpdate(t *testing.T) {
 	t.Parallel()
-	tempFile := testTempFile(t)
-	defer os.Remove(tempFile.Name())
-	handler := testHandler(t, tempFile)
+	handler := testHandler(t)
 
 	r, err := http.NewRequestWithContext(context.Background(), http.MethodPatch, "/todos/1", strings.NewReader(`{"id": 1}`))
 	if err != nil {
@@ -210,9 +215,1472 @@ func TestPatchNoFieldsToUpdate(t *testing.T) {
 		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
 	}
 
-	expectedError := strings.TrimSpace(ErrNoFieldsToUpdate.Error())
-	actualError := strings.TrimSpace(w.Body.String())
-	if actualError != expectedError {
-		t.Fatalf("expected body %q, got %q", expectedError, actualError)
+	problem := testProblem(t, w)
+	if problem.Code != CodeNoFieldsToUpdate || problem.Detail != ErrNoFieldsToUpdate.Error() {
+		t.Fatalf("expected problem %s: %s, got %+v", CodeNoFieldsToUpdate, ErrNoFieldsToUpdate, problem)
+	}
+}
+
+// testProblem decodes the problem answered in w.
+func testProblem(t *testing.T, w *httptest.ResponseRecorder) Problem {
+	if got := w.Header().Get(headerContentType); got != valueContentTypeProblem {
+		t.Fatalf("expected content type %s, got %s", valueContentTypeProblem, got)
+	}
+
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("failed to unmarshal problem: %v", err)
+	}
+	if problem.Status != w.Code {
+		t.Fatalf("expected problem status %d, got %d", w.Code, problem.Status)
+	}
+	return problem
+}
+
+func TestProblems(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	w := testServe(t, handler, http.MethodPut, "/todos/1", `{"id": 1, "title": "first"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	tests := []struct {
+		method  string
+		path    string
+		body    string
+		want    int
+		code    ErrorCode
+		pointer string
+	}{
+		{http.MethodGet, "/todos/2", "", http.StatusNotFound, CodeNotFound, ""},
+		{http.MethodGet, "/todos/x", "", http.StatusBadRequest, CodeInvalidPath, ""},
+		{http.MethodGet, "/todos?limit=0", "", http.StatusBadRequest, CodeInvalidQuery, ""},
+		{http.MethodPatch, "/todos/1", `{"id": 1}`, http.StatusBadRequest, CodeNoFieldsToUpdate, ""},
+		{http.MethodPut, "/todos/1", `{"id": 1,`, http.StatusBadRequest, CodeMalformedBody, ""},
+		{http.MethodPut, "/todos/1", `{"id": 1, "title": "first", "completed": "yes"}`, http.StatusBadRequest, CodeInvalidFields, "#/completed"},
+		{http.MethodPut, "/todos/1", `[{"id": 1}]`, http.StatusBadRequest, CodeMalformedBody, ""},
+		{http.MethodPut, "/todos/1", `{"id": 2, "title": "second"}`, http.StatusBadRequest, CodeInvalidFields, "#/id"},
+		{http.MethodPost, "/todos", `{"id": 3, "title": "third"}`, http.StatusBadRequest, CodeInvalidFields, "#/id"},
+		{http.MethodPost, "/lists", `{"name": " "}`, http.StatusBadRequest, CodeInvalidFields, "#/name"},
+		{http.MethodPut, "/todos/1", `{"id": 1, "title": "first", "parent_id": 1}`, http.StatusUnprocessableEntity, CodeParentCycle, ""},
+		{http.MethodPost, "/todos/1:complete", "", http.StatusNotFound, CodeRouteNotFound, ""},
+		{http.MethodGet, "/admin/backup", "", http.StatusNotFound, CodeRouteNotFound, ""},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, tt.method, tt.path, tt.body, nil)
+		if w.Code != tt.want {
+			t.Fatalf("%s %s: expected status code %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+
+		problem := testProblem(t, w)
+		path, _, _ := strings.Cut(tt.path, "?")
+		if problem.Code != tt.code || problem.RequestID != "123" || problem.Instance != path {
+			t.Fatalf("%s %s: expected problem %s for request 123, got %+v", tt.method, tt.path, tt.code, problem)
+		}
+		if tt.pointer != "" && (len(problem.Errors) != 1 || problem.Errors[0].Pointer != tt.pointer) {
+			t.Fatalf("%s %s: expected an error at %s, got %+v", tt.method, tt.path, tt.pointer, problem.Errors)
+		}
+	}
+
+	r, err := http.NewRequestWithContext(context.Background(), http.MethodPut, "/todos/1", strings.NewReader(`{"id": 1}`))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	w = httptest.NewRecorder()
+	handler.Mux.ServeHTTP(w, r)
+	if problem := testProblem(t, w); problem.Code != CodeInvalidContentType {
+		t.Fatalf("expected problem %s, got %+v", CodeInvalidContentType, problem)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+	mergePatch := http.Header{headerContentType: {valueContentTypeMergePatch}}
+
+	w := testServe(t, handler, http.MethodPut, "/todos/1", `{"id": 1, "title": "first", "description": "details", "tags": ["api"]}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodPatch, "/todos/1", `{"title": "renamed", "completed": true, "priority": "high", "description": null, "tags": null}`, mergePatch)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	var todo Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if todo.Title != "renamed" || !todo.Completed || todo.CompletedAt == nil || todo.Priority != PriorityHigh || todo.Description != "" || len(todo.Tags) != 0 {
+		t.Fatalf("expected the patch merged into todo 1, got %+v", todo)
+	}
+
+	w = testServe(t, handler, http.MethodPatch, "/todos/1", `{"completed": false}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if todo.Completed || todo.Title != "renamed" {
+		t.Fatalf("expected todo 1 reopened by an application/json patch, got %+v", todo)
+	}
+
+	tests := []struct {
+		body   string
+		header http.Header
+		want   int
+		code   ErrorCode
+	}{
+		{`{"id": 2, "title": "other"}`, mergePatch, http.StatusBadRequest, CodeInvalidFields},
+		{`{"title": null}`, mergePatch, http.StatusBadRequest, CodeInvalidFields},
+		{`{"completed": "yes"}`, mergePatch, http.StatusBadRequest, CodeInvalidFields},
+		{`[{"op": "remove", "path": "/title"}]`, mergePatch, http.StatusBadRequest, CodeMalformedBody},
+		{`{"title": "text"}`, http.Header{headerContentType: {"text/plain"}}, http.StatusBadRequest, CodeInvalidContentType},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, http.MethodPatch, "/todos/1", tt.body, tt.header)
+		if problem := testProblem(t, w); w.Code != tt.want || problem.Code != tt.code {
+			t.Fatalf("%s: expected status code %d and problem %s, got %d: %+v", tt.body, tt.want, tt.code, w.Code, problem)
+		}
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+	jsonPatch := http.Header{headerContentType: {valueContentTypeJSONPatch}}
+
+	w := testServe(t, handler, http.MethodPut, "/todos/1", `{"id": 1, "title": "first", "due_at": "2024-11-01T09:30:00Z", "tags": ["api"]}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	body := `[
+		{"op": "test", "path": "/title", "value": "first"},
+		{"op": "replace", "path": "/title", "value": "renamed"},
+		{"op": "add", "path": "/tags/-", "value": "urgent"},
+		{"op": "remove", "path": "/due_at"}
+	]`
+	w = testServe(t, handler, http.MethodPatch, "/todos/1", body, http.Header{headerContentType: {valueContentTypeJSONPatch}, headerIfMatch: {`"1"`}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	var todo Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if todo.Title != "renamed" || !slices.Equal(todo.Tags, []string{"api", "urgent"}) || todo.DueAt != nil || todo.Revision != 2 || w.Header().Get(headerETag) != `"2"` {
+		t.Fatalf("expected the patch applied to todo 1, got %+v", todo)
+	}
+
+	tests := []struct {
+		body    string
+		header  http.Header
+		want    int
+		code    ErrorCode
+		pointer string
+	}{
+		{`[{"op": "test", "path": "/title", "value": "first"}, {"op": "replace", "path": "/title", "value": "again"}]`, jsonPatch, http.StatusConflict, CodeJSONPatchTestFailed, ""},
+		{`[{"op": "replace", "path": "/title", "value": "again"}, {"op": "remove", "path": "/tags/5"}]`, jsonPatch, http.StatusUnprocessableEntity, CodeJSONPatchFailed, ""},
+		{`[{"op": "replace", "path": "/title", "value": "again"}, {"op": "remove", "path": "/title"}]`, jsonPatch, http.StatusBadRequest, CodeInvalidFields, "#/title"},
+		{`[{"op": "replace", "path": "/revision", "value": 7}]`, jsonPatch, http.StatusBadRequest, CodeInvalidFields, "#/0/path"},
+		{`[{"op": "replace", "path": "/done", "value": true}]`, jsonPatch, http.StatusBadRequest, CodeInvalidFields, "#/0/path"},
+		{`[{"op": "move", "path": "/title"}]`, jsonPatch, http.StatusBadRequest, CodeInvalidFields, "#/0/from"},
+		{`[{"op": "add", "path": "/tags/-"}]`, jsonPatch, http.StatusBadRequest, CodeInvalidFields, "#/0/value"},
+		{`[{"op": "rename", "path": "/title"}]`, jsonPatch, http.StatusBadRequest, CodeInvalidFields, "#/0/op"},
+		{`[]`, jsonPatch, http.StatusBadRequest, CodeInvalidFields, "#/"},
+		{`{"title": "again"}`, jsonPatch, http.StatusBadRequest, CodeMalformedBody, ""},
+		{`[{"op": "replace", "path": "/title", "value": "again"}]`, http.Header{headerContentType: {valueContentTypeJSONPatch}, headerIfMatch: {`"1"`}}, http.StatusPreconditionFailed, CodeRevisionMismatch, ""},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, http.MethodPatch, "/todos/1", tt.body, tt.header)
+		problem := testProblem(t, w)
+		if w.Code != tt.want || problem.Code != tt.code {
+			t.Fatalf("%s: expected status code %d and problem %s, got %d: %+v", tt.body, tt.want, tt.code, w.Code, problem)
+		}
+		if tt.pointer != "" && (len(problem.Errors) != 1 || problem.Errors[0].Pointer != tt.pointer) {
+			t.Fatalf("%s: expected an error at %s, got %+v", tt.body, tt.pointer, problem.Errors)
+		}
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos/1", "", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if todo.Title != "renamed" || todo.Revision != 2 {
+		t.Fatalf("expected todo 1 unchanged by the failed patches, got %+v", todo)
+	}
+
+	// A patch that changes nothing answers the todo as it is.
+	w = testServe(t, handler, http.MethodPatch, "/todos/1", `[{"op": "test", "path": "/title", "value": "renamed"}, {"op": "test", "path": "/revision", "value": 2}]`, jsonPatch)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if todo.Title != "renamed" || todo.Revision != 2 || w.Header().Get(headerETag) != `"2"` {
+		t.Fatalf("expected todo 1 unchanged at revision 2, got %+v", todo)
+	}
+
+	w = testServe(t, handler, http.MethodPatch, "/todos/1", `{"title": "again"}`, http.Header{headerContentType: {"text/plain"}})
+	if problem := testProblem(t, w); problem.Code != CodeInvalidContentType || !strings.Contains(w.Header().Get(headerAcceptPatch), valueContentTypeJSONPatch) {
+		t.Fatalf("expected problem %s with the accepted patches, got %+v, %q", CodeInvalidContentType, problem, w.Header().Get(headerAcceptPatch))
+	}
+
+	w = testServe(t, handler, http.MethodPatch, "/todos/2", `[{"op": "replace", "path": "/title", "value": "again"}]`, jsonPatch)
+	if problem := testProblem(t, w); w.Code != http.StatusNotFound || problem.Code != CodeNotFound {
+		t.Fatalf("expected status code %d, got %d: %+v", http.StatusNotFound, w.Code, problem)
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	for _, body := range []string{`{"id": 1, "title": "Ship it, today", "tags": ["api"]}`, `{"id": 2, "title": "Write \"docs\"", "completed": true}`} {
+		var todo Todo
+		if err := json.Unmarshal([]byte(body), &todo); err != nil {
+			t.Fatalf("failed to unmarshal todo: %v", err)
+		}
+		w := testServe(t, handler, http.MethodPut, fmt.Sprintf("/todos/%d", todo.ID), body, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	tests := []struct {
+		path        string
+		accept      string
+		contentType string
+		want        []string
+	}{
+		{"/todos", "text/csv", "text/csv; charset=utf-8", []string{"id,title,description,completed,", `1,"Ship it, today",,false,normal,`, `2,"Write ""docs""",,true,normal,`}},
+		{"/todos/1", "text/csv", "text/csv; charset=utf-8", []string{"id,title,", `1,"Ship it, today",`}},
+		{"/todos", "application/yaml", "application/yaml", []string{"- id: 1\n  title: \"Ship it, today\"\n", "  tags: [\"api\"]\n", "- id: 2\n  title: \"Write \\\"docs\\\"\"\n"}},
+		{"/todos/2", "application/yaml", "application/yaml", []string{"id: 2\ntitle: \"Write \\\"docs\\\"\"\n", "completed: true\n"}},
+		{"/todos", "application/x-ndjson", "application/x-ndjson", []string{`{"id":1,"title":"Ship it, today",`, "\n" + `{"id":2,"title":"Write \"docs\"",`}},
+		{"/todos", "text/plain", "text/plain; charset=utf-8", []string{"- [ ] Ship it, today\n- [x] Write \"docs\"\n"}},
+		{"/todos/2", "text/markdown", "text/markdown; charset=utf-8", []string{"- [x] Write \"docs\"\n"}},
+		{"/todos?completed=false", "text/markdown, application/json;q=0.5", "text/markdown; charset=utf-8", []string{"- [ ] Ship it, today\n"}},
+		{"/todos/1", "", valueContentTypeJSON, []string{`{"id":1,"title":"Ship it, today",`}},
+		{"/todos", "*/*", valueContentTypeJSON, []string{`[{"id":1,`}},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, http.MethodGet, tt.path, "", http.Header{headerAccept: {tt.accept}})
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s as %s: expected status code %d, got %d: %s", tt.path, tt.accept, http.StatusOK, w.Code, w.Body)
+		}
+		if got := w.Header().Get(headerContentType); got != tt.contentType || w.Header().Get(headerVary) != headerAccept {
+			t.Fatalf("%s as %s: expected content type %s varying by Accept, got %s", tt.path, tt.accept, tt.contentType, got)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(w.Body.String(), want) {
+				t.Fatalf("%s as %s: expected body to contain %q, got\n%s", tt.path, tt.accept, want, w.Body)
+			}
+		}
+	}
+
+	for _, path := range []string{"/todos", "/todos/1"} {
+		w := testServe(t, handler, http.MethodGet, path, "", http.Header{headerAccept: {"text/html, application/xml"}})
+		if problem := testProblem(t, w); w.Code != http.StatusNotAcceptable || problem.Code != CodeNotAcceptable {
+			t.Fatalf("%s: expected status code %d, got %d: %+v", path, http.StatusNotAcceptable, w.Code, problem)
+		}
+	}
+
+	// Each representation has its own ETag, a CSV one does not validate JSON.
+	w := testServe(t, handler, http.MethodGet, "/todos/1", "", http.Header{headerAccept: {"text/csv"}})
+	csvTag := w.Header().Get(headerETag)
+	if csvTag != `"1-csv"` {
+		t.Fatalf("expected etag %s, got %s", `"1-csv"`, csvTag)
+	}
+	w = testServe(t, handler, http.MethodGet, "/todos/1", "", http.Header{headerAccept: {"text/csv"}, headerIfNoneMatch: {csvTag}})
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected status code %d, got %d", http.StatusNotModified, w.Code)
+	}
+	w = testServe(t, handler, http.MethodGet, "/todos/1", "", http.Header{headerIfNoneMatch: {csvTag}})
+	if w.Code != http.StatusOK || w.Header().Get(headerETag) != `"1"` {
+		t.Fatalf("expected status code %d with etag %s, got %d with %s", http.StatusOK, `"1"`, w.Code, w.Header().Get(headerETag))
+	}
+
+	// Any of them is a precondition on the revision.
+	w = testServe(t, handler, http.MethodPatch, "/todos/1", `{"priority": "high"}`, http.Header{headerContentType: {valueContentTypeMergePatch}, headerIfMatch: {csvTag}})
+	if w.Code != http.StatusOK || w.Header().Get(headerETag) != `"2"` {
+		t.Fatalf("expected status code %d with etag %s, got %d: %s", http.StatusOK, `"2"`, w.Code, w.Body)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	w := testServe(t, handler, http.MethodPut, "/todos/1", `{"id": 1, "title": "first"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	long := strings.Repeat("é", MaxDescriptionLength+1)
+	tests := []struct {
+		method   string
+		path     string
+		body     string
+		pointers []string
+	}{
+		{http.MethodPost, "/todos", `{"title": " ", "description": "` + long + `", "due": "tomorrow", "list_id": -1}`, []string{"#/due", "#/title", "#/description", "#/list_id"}},
+		{http.MethodPut, "/todos/2", `{"id": 3, "title": "` + strings.Repeat("a", MaxTitleLength+1) + `"}`, []string{"#/title", "#/id"}},
+		{http.MethodPut, "/todos/2", `{"id": 2, "title": "tagged", "tags": ["` + strings.Repeat("a", MaxTagLength+1) + `"]}`, []string{"#/tags/0"}},
+		{http.MethodPatch, "/todos/1", `{"id": 1, "add_tags": ["` + strings.Repeat("a", MaxTagLength+1) + `"], "done": true, "status": "closed"}`, []string{"#/done", "#/status", "#/add_tags/0"}},
+		{http.MethodPut, "/todos/1", `{"id": 1, "title": "", "priority": "bogus", "description": 5, "extra": 1}`, []string{"#/description", "#/priority", "#/extra", "#/title"}},
+		{http.MethodPost, "/todos", `{"title": "t", "due_at": "tomorrow", "tags": "api"}`, []string{"#/due_at", "#/tags"}},
+		{http.MethodPatch, "/todos/1", `{"title": 5}`, []string{"#/title"}},
+		{http.MethodPost, "/lists", `{"name": "` + strings.Repeat("a", MaxListNameLength+1) + `", "color": "red"}`, []string{"#/color", "#/name"}},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, tt.method, tt.path, tt.body, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s %s: expected status code %d, got %d", tt.method, tt.path, http.StatusBadRequest, w.Code)
+		}
+
+		problem := testProblem(t, w)
+		var pointers []string
+		for _, field := range problem.Errors {
+			pointers = append(pointers, field.Pointer)
+		}
+		if problem.Code != CodeInvalidFields || !slices.Equal(pointers, tt.pointers) {
+			t.Fatalf("%s %s: expected errors at %v, got %+v", tt.method, tt.path, tt.pointers, problem)
+		}
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos/1", "", nil)
+	var todo Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if todo.Title != "first" || todo.Revision != 1 {
+		t.Fatalf("expected todo 1 unchanged by invalid writes, got %+v", todo)
+	}
+
+	w = testServe(t, handler, http.MethodPost, "/todos", `{"title": "`+strings.Repeat("a", MaxBodyBytes)+`"}`, nil)
+	if problem := testProblem(t, w); w.Code != http.StatusRequestEntityTooLarge || problem.Code != CodeBodyTooLarge {
+		t.Fatalf("expected status code %d, got %d: %+v", http.StatusRequestEntityTooLarge, w.Code, problem)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	r, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "/todos", strings.NewReader(`{"id": 1, "title": "test"}`))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	handler.Mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	for want := 1; want <= 2; want++ {
+		r, err = http.NewRequestWithContext(context.Background(), http.MethodPost, "/todos", strings.NewReader(`{"title": "test", "description": "test"}`))
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		r.Header.Set("Content-Type", "application/json")
+
+		w = httptest.NewRecorder()
+		handler.Mux.ServeHTTP(w, r)
+
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+
+		location := fmt.Sprintf("/todos/%d", want)
+		if w.Header().Get("Location") != location {
+			t.Fatalf("expected location %s, got %s", location, w.Header().Get("Location"))
+		}
+
+		var body Todo
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to unmarshal body: %v", err)
+		}
+
+		if body.ID != want || body.Title != "test" {
+			t.Fatalf("expected todo %d titled %s, got %v", want, "test", body)
+		}
+	}
+}
+
+func TestPutCreatesThenReplaces(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	w := testServe(t, handler, http.MethodPut, "/todos/1", `{"id": 1, "title": "first"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+	if w.Header().Get("Location") != "/todos/1" {
+		t.Fatalf("expected location %s, got %s", "/todos/1", w.Header().Get("Location"))
+	}
+
+	w = testServe(t, handler, http.MethodPut, "/todos/1", `{"id": 1, "title": "second"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var body Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if body.Title != "second" {
+		t.Fatalf("expected title %s, got %s", "second", body.Title)
+	}
+}
+
+func TestPutIfNoneMatch(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+	header := http.Header{"If-None-Match": []string{"*"}}
+
+	w := testServe(t, handler, http.MethodPut, "/todos/1", `{"id": 1, "title": "first"}`, header)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodPut, "/todos/1", `{"id": 1, "title": "second"}`, header)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected status code %d, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos/1", "", nil)
+	var body Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if body.Title != "first" {
+		t.Fatalf("expected title %s, got %s", "first", body.Title)
+	}
+}
+
+func TestPatchMissingTodo(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	w := testServe(t, handler, http.MethodPatch, "/todos/1", `{"id": 1, "description": null}`, nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos/1", "", nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected status code %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	w := testServe(t, handler, http.MethodPut, "/todos/1", `{"id": 1, "title": "first"}`, http.Header{"If-Match": []string{`"1"`}})
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected status code %d, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodPut, "/todos/1", `{"id": 1, "title": "first"}`, nil)
+	if w.Header().Get("ETag") != `"1"` {
+		t.Fatalf("expected etag %s, got %s", `"1"`, w.Header().Get("ETag"))
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos/1", "", http.Header{"If-None-Match": []string{`"1"`}})
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected status code %d, got %d", http.StatusNotModified, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodPatch, "/todos/1", `{"id": 1, "description": null}`, http.Header{"If-Match": []string{`"1"`}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected etag %s, got %s", `"2"`, w.Header().Get("ETag"))
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos/1", "", http.Header{"If-None-Match": []string{`"1"`}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	stale := http.Header{"If-Match": []string{`"1"`}}
+	tests := []struct {
+		method string
+		body   string
+	}{
+		{http.MethodPut, `{"id": 1, "title": "stale"}`},
+		{http.MethodPatch, `{"id": 1, "description": null}`},
+		{http.MethodDelete, ""},
+	}
+	for _, tt := range tests {
+		w = testServe(t, handler, tt.method, "/todos/1", tt.body, stale)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Fatalf("%s: expected status code %d, got %d", tt.method, http.StatusPreconditionFailed, w.Code)
+		}
+	}
+
+	w = testServe(t, handler, http.MethodDelete, "/todos/1", "", http.Header{"If-Match": []string{"2"}})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	// If-Match compares strongly, so a weak ETag never matches, even the
+	// current revision.
+	weak := http.Header{"If-Match": []string{`W/"2"`}}
+	for _, tt := range tests {
+		w = testServe(t, handler, tt.method, "/todos/1", tt.body, weak)
+		if w.Code != http.StatusPreconditionFailed {
+			t.Fatalf("%s: expected status code %d, got %d", tt.method, http.StatusPreconditionFailed, w.Code)
+		}
+		if problem := testProblem(t, w); problem.Code != CodeRevisionMismatch {
+			t.Fatalf("%s: expected code %s, got %s", tt.method, CodeRevisionMismatch, problem.Code)
+		}
+	}
+
+	w = testServe(t, handler, http.MethodDelete, "/todos/1", "", http.Header{"If-Match": []string{`"2"`}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestGetAllPages(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	for range 5 {
+		w := testServe(t, handler, http.MethodPost, "/todos", `{"title": "test"}`, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	var ids []int
+	path := "/todos?limit=2"
+	for pages := 0; path != ""; pages++ {
+		if pages > 3 {
+			t.Fatalf("expected 3 pages, got more")
+		}
+
+		w := testServe(t, handler, http.MethodGet, path, "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+		}
+
+		var body []Todo
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to unmarshal body: %v", err)
+		}
+		for _, todo := range body {
+			ids = append(ids, todo.ID)
+		}
+
+		path = ""
+		if link := w.Header().Get("Link"); link != "" {
+			next, ok := strings.CutSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			if !ok {
+				t.Fatalf("unexpected link %s", link)
+			}
+			path = next
+		}
+	}
+
+	if !reflect.DeepEqual(ids, []int{1, 2, 3, 4, 5}) {
+		t.Fatalf("expected ids %v, got %v", []int{1, 2, 3, 4, 5}, ids)
+	}
+
+	for _, path := range []string{"/todos?limit=0", "/todos?limit=1001", "/todos?limit=a", "/todos?cursor=!"} {
+		w := testServe(t, handler, http.MethodGet, path, "", nil)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status code %d, got %d", path, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestGetAllFilters(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	for _, body := range []string{
+		`{"title": "b", "completed": true}`,
+		`{"title": "a", "completed": false}`,
+		`{"title": "c", "completed": true}`,
+	} {
+		w := testServe(t, handler, http.MethodPost, "/todos", body, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	w := testServe(t, handler, http.MethodGet, "/todos?completed=true&sort=-id&limit=1", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var body []Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if len(body) != 1 || body[0].ID != 3 {
+		t.Fatalf("expected todo 3, got %v", body)
+	}
+
+	link := w.Header().Get("Link")
+	if !strings.Contains(link, "completed=true") || !strings.Contains(link, "sort=-id") {
+		t.Fatalf("expected link to keep the filters, got %s", link)
+	}
+
+	cursor := CursorOf(Sort{Field: SortByID, Desc: true}, body[0]).Encode()
+	for _, path := range []string{
+		"/todos?done=true",
+		"/todos?completed=yes",
+		"/todos?sort=description",
+		"/todos?sort=title&cursor=" + cursor,
+	} {
+		w := testServe(t, handler, http.MethodGet, path, "", nil)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status code %d, got %d", path, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestGetAllTimeFilters(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	w := testServe(t, handler, http.MethodPost, "/todos", `{"title": "test", "created_at": "2000-01-01T00:00:00Z"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var created map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	createdAt, err := time.Parse(time.RFC3339, created["created_at"].(string))
+	if err != nil {
+		t.Fatalf("expected created_at in RFC 3339, got %v", created["created_at"])
+	}
+	if createdAt.Year() == 2000 {
+		t.Fatalf("expected created_at to be set by the server, got %v", createdAt)
+	}
+	if created["completed_at"] != nil {
+		t.Fatalf("expected completed_at to be null, got %v", created["completed_at"])
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"created_after=" + createdAt.Format(time.RFC3339Nano), 1},
+		{"created_before=" + createdAt.Format(time.RFC3339Nano), 0},
+		{"updated_after=2000-01-01T00:00:00Z", 1},
+		{"completed_after=2000-01-01T00:00:00Z", 0},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, http.MethodGet, "/todos?"+tt.query, "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status code %d, got %d", tt.query, http.StatusOK, w.Code)
+		}
+
+		var body []Todo
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to unmarshal body: %v", err)
+		}
+		if len(body) != tt.want {
+			t.Fatalf("%s: expected %d todos, got %d", tt.query, tt.want, len(body))
+		}
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos?created_after=yesterday", "", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestDueDates(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	w := testServe(t, handler, http.MethodPost, "/todos", `{"title": "overdue", "due_at": "2000-01-01T01:00:00+01:00"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	var created Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if created.DueAt == nil || !created.DueAt.Equal(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected todo due at 2000-01-01T00:00:00Z, got %v", created.DueAt)
+	}
+
+	w = testServe(t, handler, http.MethodPost, "/todos", `{"title": "undated"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"overdue=true", 1},
+		{"overdue=false", 1},
+		{"due_before=2000-01-02T00:00:00Z", 1},
+		{"due_after=2000-01-02T00:00:00Z", 0},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, http.MethodGet, "/todos?"+tt.query, "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status code %d, got %d", tt.query, http.StatusOK, w.Code)
+		}
+
+		var body []Todo
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to unmarshal body: %v", err)
+		}
+		if len(body) != tt.want {
+			t.Fatalf("%s: expected %d todos, got %d", tt.query, tt.want, len(body))
+		}
+	}
+
+	path := fmt.Sprintf("/todos/%d", created.ID)
+	w = testServe(t, handler, http.MethodPatch, path, fmt.Sprintf(`{"id": %d, "due_at": null}`, created.ID), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var patched Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &patched); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if patched.DueAt != nil {
+		t.Fatalf("expected due date to be removed, got %v", patched.DueAt)
+	}
+
+	for _, body := range []string{`"tomorrow"`, "1"} {
+		body = fmt.Sprintf(`{"id": %d, "due_at": %s}`, created.ID, body)
+		w = testServe(t, handler, http.MethodPatch, path, body, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status code %d, got %d", body, http.StatusBadRequest, w.Code)
+		}
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos?overdue=yes", "", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestPriority(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	for i, priority := range []string{"high", "low", "urgent"} {
+		body := fmt.Sprintf(`{"id": %d, "title": "test", "priority": %q}`, i+1, priority)
+		w := testServe(t, handler, http.MethodPut, fmt.Sprintf("/todos/%d", i+1), body, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	w := testServe(t, handler, http.MethodPost, "/todos", `{"title": "test"}`, nil)
+	var created Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if created.Priority != PriorityNormal {
+		t.Fatalf("expected priority %s by default, got %s", PriorityNormal, created.Priority)
+	}
+
+	w = testServe(t, handler, http.MethodPatch, "/todos/2", `{"id": 2, "priority": "urgent"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos?sort=-priority", "", nil)
+	var body []Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	var ids []int
+	for _, todo := range body {
+		ids = append(ids, todo.ID)
+	}
+	if want := []int{3, 2, 1, 4}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("expected ids %v, got %v", want, ids)
+	}
+
+	tests := []struct {
+		method string
+		body   string
+	}{
+		{http.MethodPut, `{"id": 1, "title": "test", "priority": "asap"}`},
+		{http.MethodPut, `{"id": 1, "title": "test", "priority": 3}`},
+		{http.MethodPatch, `{"id": 1, "priority": "asap"}`},
+		{http.MethodPatch, `{"id": 1, "priority": 3}`},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, tt.method, "/todos/1", tt.body, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s %s: expected status code %d, got %d", tt.method, tt.body, http.StatusBadRequest, w.Code)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	for _, body := range []string{
+		`{"title": "one", "tags": ["backend", "urgent"]}`,
+		`{"title": "two", "tags": ["backend"]}`,
+		`{"title": "three"}`,
+	} {
+		w := testServe(t, handler, http.MethodPost, "/todos", body, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	w := testServe(t, handler, http.MethodPatch, "/todos/3", `{"id": 3, "add_tags": ["urgent"]}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"tag=backend&tag=urgent", []int{1, 2, 3}},
+		{"tag=backend&tag=urgent&tag_match=all", []int{1}},
+		{"tag=urgent&tag_match=any", []int{1, 3}},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, http.MethodGet, "/todos?"+tt.query, "", nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status code %d, got %d", tt.query, http.StatusOK, w.Code)
+		}
+
+		var body []Todo
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to unmarshal body: %v", err)
+		}
+		var ids []int
+		for _, todo := range body {
+			ids = append(ids, todo.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Fatalf("%s: expected ids %v, got %v", tt.query, tt.want, ids)
+		}
+	}
+
+	w = testServe(t, handler, http.MethodPatch, "/todos/1", `{"id": 1, "tags": ["api"], "remove_tags": ["backend"]}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/tags", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	want := `[{"name":"api","count":1},{"name":"backend","count":1},{"name":"urgent","count":1}]`
+	if got := strings.TrimSpace(w.Body.String()); got != want {
+		t.Fatalf("expected tags %s, got %s", want, got)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos?tag=a&tag_match=some", "", nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodPatch, "/todos/1", `{"id": 1, "tags": "api"}`, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status code %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestListEndpoints(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	w := testServe(t, handler, http.MethodPost, "/lists", `{"name": "Backend"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+	if location := w.Header().Get(headerLocation); location != "/lists/1" {
+		t.Fatalf("expected location /lists/1, got %s", location)
+	}
+
+	w = testServe(t, handler, http.MethodPost, "/lists/1/todos", `{"title": "in list"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+	w = testServe(t, handler, http.MethodPost, "/todos", `{"title": "inbox"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/lists/1/todos", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var todos []Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &todos); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if len(todos) != 1 || todos[0].Title != "in list" || todos[0].ListID == nil || *todos[0].ListID != 1 {
+		t.Fatalf("expected the todo in list 1, got %v", todos)
+	}
+
+	w = testServe(t, handler, http.MethodPut, "/lists/1", `{"name": "API"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	w = testServe(t, handler, http.MethodGet, "/lists/1", "", nil)
+	var list List
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if list.Name != "API" {
+		t.Fatalf("expected list to be renamed API, got %v", list)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{http.MethodPost, "/lists", `{"name": " "}`, http.StatusBadRequest},
+		{http.MethodPost, "/lists", `{"id": 2, "name": "Frontend"}`, http.StatusBadRequest},
+		{http.MethodGet, "/lists/2", "", http.StatusNotFound},
+		{http.MethodPut, "/lists/2", `{"name": "Frontend"}`, http.StatusNotFound},
+		{http.MethodGet, "/lists/2/todos", "", http.StatusNotFound},
+		{http.MethodPost, "/lists/2/todos", `{"title": "lost"}`, http.StatusNotFound},
+		{http.MethodPost, "/lists/1/todos", `{"title": "moved", "list_id": 2}`, http.StatusBadRequest},
+		{http.MethodPost, "/todos", `{"title": "lost", "list_id": 2}`, http.StatusUnprocessableEntity},
+		{http.MethodPatch, "/todos/2", `{"id": 2, "list_id": 2}`, http.StatusUnprocessableEntity},
+		{http.MethodDelete, "/lists/1?cascade=maybe", "", http.StatusBadRequest},
+		{http.MethodDelete, "/lists/1", "", http.StatusConflict},
+		{http.MethodDelete, "/lists/1?cascade=true", "", http.StatusOK},
+		{http.MethodGet, "/todos/1", "", http.StatusNotFound},
+		{http.MethodGet, "/todos/2", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, tt.method, tt.path, tt.body, nil)
+		if w.Code != tt.want {
+			t.Fatalf("%s %s: expected status code %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestChildren(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	for _, body := range []string{
+		`{"title": "epic"}`,
+		`{"title": "step", "parent_id": 1}`,
+		`{"title": "substep", "parent_id": 2}`,
+		`{"title": "other step", "parent_id": 1}`,
+	} {
+		w := testServe(t, handler, http.MethodPost, "/todos", body, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	w := testServe(t, handler, http.MethodGet, "/todos/1/children?limit=1", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var children []Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &children); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if len(children) != 1 || children[0].ID != 2 {
+		t.Fatalf("expected child 2, got %v", children)
+	}
+	if link := w.Header().Get(headerLink); !strings.HasPrefix(link, "</todos/1/children?") {
+		t.Fatalf("expected link to the next page of children, got %s", link)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos/1/children?tree=true", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var tree TodoTree
+	if err := json.Unmarshal(w.Body.Bytes(), &tree); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if tree.ID != 1 || len(tree.Children) != 2 || tree.Children[0].ID != 2 || len(tree.Children[0].Children) != 1 || tree.Children[0].Children[0].ID != 3 || tree.Children[1].ID != 4 {
+		t.Fatalf("expected todo 1 with children 2, holding 3, and 4, got %+v", tree)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{http.MethodGet, "/todos/5/children", "", http.StatusNotFound},
+		{http.MethodGet, "/todos/5/children?tree=true", "", http.StatusNotFound},
+		{http.MethodGet, "/todos/1/children?tree=yes", "", http.StatusBadRequest},
+		{http.MethodGet, "/todos/1/children?tree=true&limit=1", "", http.StatusBadRequest},
+		{http.MethodPost, "/todos", `{"title": "orphan", "parent_id": 5}`, http.StatusUnprocessableEntity},
+		{http.MethodPatch, "/todos/1", `{"id": 1, "parent_id": 3}`, http.StatusUnprocessableEntity},
+		{http.MethodPatch, "/todos/1", `{"id": 1, "parent_id": "3"}`, http.StatusBadRequest},
+		{http.MethodPatch, "/todos/2", `{"id": 2, "completed": null, "parent_id": null}`, http.StatusOK},
+		{http.MethodPut, "/todos/1", `{"id": 1, "title": "epic", "completed": true}`, http.StatusConflict},
+		{http.MethodDelete, "/todos/2", "", http.StatusConflict},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, tt.method, tt.path, tt.body, nil)
+		if w.Code != tt.want {
+			t.Fatalf("%s %s: expected status code %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestBlockers(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	for _, body := range []string{
+		`{"title": "design"}`,
+		`{"title": "build", "priority": "urgent"}`,
+		`{"title": "docs"}`,
+	} {
+		w := testServe(t, handler, http.MethodPost, "/todos", body, nil)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+		}
+	}
+
+	w := testServe(t, handler, http.MethodPut, "/todos/2/blockers/1", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos/2/blockers", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var blockers []Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &blockers); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if len(blockers) != 1 || blockers[0].ID != 1 {
+		t.Fatalf("expected blocker 1, got %v", blockers)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos?blocked=true", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var blocked []Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &blocked); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if len(blocked) != 1 || blocked[0].ID != 2 {
+		t.Fatalf("expected blocked todo 2, got %v", blocked)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos:next?limit=2", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var next []Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &next); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if len(next) != 2 || next[0].ID != 1 || next[1].ID != 2 {
+		t.Fatalf("expected next todos 1 and 2, got %v", next)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{http.MethodPut, "/todos/1/blockers/2", "", http.StatusUnprocessableEntity},
+		{http.MethodPut, "/todos/1/blockers/4", "", http.StatusNotFound},
+		{http.MethodPut, "/todos/1/blockers/x", "", http.StatusBadRequest},
+		{http.MethodGet, "/todos/4/blockers", "", http.StatusNotFound},
+		{http.MethodGet, "/todos?blocked=yes", "", http.StatusBadRequest},
+		{http.MethodGet, "/todos:next?limit=0", "", http.StatusBadRequest},
+		{http.MethodGet, "/todos:next?completed=false", "", http.StatusBadRequest},
+		{http.MethodPut, "/todos/2", `{"id": 2, "title": "build", "completed": true}`, http.StatusConflict},
+		{http.MethodDelete, "/todos/2/blockers/1", "", http.StatusOK},
+		{http.MethodDelete, "/todos/2/blockers/1", "", http.StatusNotFound},
+		{http.MethodPut, "/todos/2", `{"id": 2, "title": "build", "completed": true}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, tt.method, tt.path, tt.body, nil)
+		if w.Code != tt.want {
+			t.Fatalf("%s %s: expected status code %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestBatchEndpoint(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	w := testServe(t, handler, http.MethodPost, "/todos", `{"title": "first"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodPost, "/todos:batch", `{"ops": [
+		{"op": "put", "id": 2, "todo": {"title": "second"}},
+		{"op": "patch", "id": 1, "revision": 1, "patch": {"priority": "high"}},
+		{"op": "delete", "id": 2}
+	]}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response batchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if response.Index != nil || len(response.Results) != 3 {
+		t.Fatalf("expected 3 results, got %+v", response)
+	}
+	for i, want := range []int{http.StatusCreated, http.StatusOK, http.StatusOK} {
+		if response.Results[i].Index != i || response.Results[i].Status != want {
+			t.Fatalf("expected result %d with status %d, got %+v", i, want, response.Results[i])
+		}
+	}
+	if todo := response.Results[1].Todo; todo == nil || todo.Priority != PriorityHigh {
+		t.Fatalf("expected todo 1 with priority high, got %+v", todo)
+	}
+
+	w = testServe(t, handler, http.MethodPost, "/todos:batch", `{"ops": [
+		{"op": "patch", "id": 1, "patch": {"priority": "low"}},
+		{"op": "patch", "id": 1, "revision": 1, "patch": {"priority": "urgent"}},
+		{"op": "delete", "id": 1}
+	]}`, nil)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected status code %d, got %d", http.StatusPreconditionFailed, w.Code)
+	}
+	response = batchResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if response.Index == nil || *response.Index != 1 {
+		t.Fatalf("expected op 1 to fail, got %+v", response)
+	}
+	for i, want := range []int{http.StatusFailedDependency, http.StatusPreconditionFailed, http.StatusFailedDependency} {
+		if response.Results[i].Status != want {
+			t.Fatalf("expected result %d with status %d, got %+v", i, want, response.Results[i])
+		}
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos/1", "", nil)
+	var todo Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &todo); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if todo.Priority != PriorityHigh || todo.Revision != 2 {
+		t.Fatalf("expected todo 1 unchanged by the failed batch, got %+v", todo)
+	}
+
+	tests := []struct {
+		body    string
+		pointer string
+		want    string
+	}{
+		{`{"ops": []}`, "#/ops", "invalid number of ops"},
+		{`{"ops": [{"op": "delete", "id": 1}, {"op": "complete", "id": 1}]}`, "#/ops/1", "invalid op"},
+		{`{"ops": [{"op": "put", "id": 1}]}`, "#/ops/0", "todo is required"},
+		{`{"ops": [{"op": "put", "id": 1, "todo": {"id": 2, "title": "second"}}]}`, "#/ops/0", "id `1` and body id `2` do not match"},
+		{`{"ops": [{"op": "patch", "patch": {"priority": "high"}}]}`, "#/ops/0", "id is required"},
+		{`{"ops": [{"op": "delete", "id": 1, "revision": -1}]}`, "#/ops/0", "invalid revision"},
+		{`{"ops": [{"op": "delete", "id": 1, "force": true}]}`, "#/ops/0/force", "unknown field"},
+		{`{"ops": [{"op": "put", "id": 1, "todo": {"title": " "}}]}`, "#/ops/0/todo/title", "must not be empty"},
+		{`{"ops": [{"op": "patch", "id": 1, "patch": {"done": true}}]}`, "#/ops/0/patch/done", "unknown field"},
+		{`{"ops": [{"op": "put", "id": 1, "todo": {"title": "t", "priority": "asap"}}]}`, "#/ops/0/todo/priority", "invalid priority"},
+		{`{"ops": {}}`, "#/ops", "must be of type"},
+		{`{"ops": [}`, "", "failed to decode batch body"},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, http.MethodPost, "/todos:batch", tt.body, nil)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected status code %d, got %d", tt.body, http.StatusBadRequest, w.Code)
+		}
+
+		problem := testProblem(t, w)
+		if tt.pointer == "" {
+			if problem.Code != CodeMalformedBody || !strings.Contains(problem.Detail, tt.want) {
+				t.Fatalf("%s: expected malformed body %q, got %+v", tt.body, tt.want, problem)
+			}
+			continue
+		}
+		if problem.Code != CodeInvalidFields || len(problem.Errors) != 1 || problem.Errors[0].Pointer != tt.pointer || !strings.Contains(problem.Errors[0].Detail, tt.want) {
+			t.Fatalf("%s: expected error %q at %s, got %+v", tt.body, tt.want, tt.pointer, problem)
+		}
+	}
+}
+
+func TestTrashEndpoints(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	w := testServe(t, handler, http.MethodPost, "/todos", `{"title": "first"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodDelete, "/todos/1", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/trash", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var trash []Todo
+	if err := json.Unmarshal(w.Body.Bytes(), &trash); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != 1 || trash[0].DeletedAt == nil {
+		t.Fatalf("expected todo 1 in the trash, got %v", trash)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		header http.Header
+		want   int
+	}{
+		{http.MethodGet, "/todos/1", "", nil, http.StatusNotFound},
+		{http.MethodDelete, "/todos/1", "", nil, http.StatusNotFound},
+		{http.MethodPut, "/todos/1", `{"id": 1, "title": "first"}`, nil, http.StatusConflict},
+		{http.MethodPost, "/todos/1", "", nil, http.StatusNotFound},
+		{http.MethodPost, "/todos/1:complete", "", nil, http.StatusNotFound},
+		{http.MethodPost, "/todos/x:restore", "", nil, http.StatusBadRequest},
+		{http.MethodPost, "/todos/2:restore", "", nil, http.StatusNotFound},
+		{http.MethodPost, "/todos/1:restore", "", http.Header{headerIfMatch: {`"1"`}}, http.StatusPreconditionFailed},
+		{http.MethodPost, "/todos/1:restore", "", http.Header{headerIfMatch: {`"2"`}}, http.StatusOK},
+		{http.MethodPost, "/todos/1:restore", "", nil, http.StatusConflict},
+		{http.MethodGet, "/todos/1", "", nil, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := testServe(t, handler, tt.method, tt.path, tt.body, tt.header)
+		if w.Code != tt.want {
+			t.Fatalf("%s %s: expected status code %d, got %d", tt.method, tt.path, tt.want, w.Code)
+		}
+	}
+}
+
+func TestHistoryEndpoint(t *testing.T) {
+	t.Parallel()
+	handler := testHandler(t)
+
+	w := testServe(t, handler, http.MethodPost, "/todos", `{"title": "first"}`, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d", http.StatusCreated, w.Code)
+	}
+	w = testServe(t, handler, http.MethodPatch, "/todos/1", `{"id": 1, "description": null}`, http.Header{headerXUser: {"alice"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	w = testServe(t, handler, http.MethodPut, "/todos/1", `{"id": 1, "title": "renamed"}`, http.Header{headerXUser: {"bob"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+
+	w = testServe(t, handler, http.MethodGet, "/todos/1/history", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, w.Code)
+	}
+	var entries []HistoryEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to unmarshal body: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 history entries, got %v", entries)
+	}
+	for i, caller := range []string{anonymousUser, "alice", "bob"} {
+		if entries[i].Caller != caller || entries[i].RequestID != "123" {
+			t.Fatalf("entry %d: expected caller %s and request 123, got %v", i, caller, entries[i])
+		}
+	}
+	if title := entries[2].Changes["title"]; string(title.Before) != `"first"` || string(title.After) != `"renamed"` {
+		t.Fatalf("expected title to change from first to renamed, got %v", title)
+	}
+
+	for path, want := range map[string]int{"/todos/x/history": http.StatusBadRequest, "/todos/2/history": http.StatusNotFound} {
+		w := testServe(t, handler, http.MethodGet, path, "", nil)
+		if w.Code != want {
+			t.Fatalf("%s: expected status code %d, got %d", path, want, w.Code)
+		}
+	}
+}
+
+func TestBackupEndpoint(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	newHandler := func(store Store, adminToken string) *Handler {
+		handler, err := FromConfig(&Config{
+			Store:              store,
+			Slog:               slog.New(slog.NewJSONHandler(io.Discard, nil)),
+			RequestIDGenerator: func() string { return "123" },
+			AdminToken:         adminToken,
+		})
+		if err != nil {
+			t.Fatalf("failed to create handler: %v", err)
+		}
+		return handler
+	}
+
+	admin := http.Header{headerAuthorization: {"Bearer secret"}}
+	tests := []struct {
+		name    string
+		handler *Handler
+		header  http.Header
+		want    int
+	}{
+		{"no admin token configured", newHandler(db, ""), admin, http.StatusNotFound},
+		{"no token", newHandler(db, "secret"), nil, http.StatusUnauthorized},
+		{"wrong token", newHandler(db, "secret"), http.Header{headerAuthorization: {"Bearer guess"}}, http.StatusUnauthorized},
+		{"memory store", newHandler(NewMemoryStore(), "secret"), admin, http.StatusNotImplemented},
+		{"admin", newHandler(db, "secret"), admin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := testServe(t, tt.handler, http.MethodGet, "/admin/backup", "", tt.header)
+		if w.Code != tt.want {
+			t.Fatalf("%s: expected status code %d, got %d", tt.name, tt.want, w.Code)
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		if got := w.Header().Get(headerContentType); got != valueContentTypeDB {
+			t.Fatalf("expected content type %s, got %s", valueContentTypeDB, got)
+		}
+		if !strings.HasPrefix(w.Body.String(), "SQLite format 3\x00") {
+			t.Fatalf("expected a SQLite database, got %q", w.Body.String()[:16])
+		}
+	}
+}
+
+type failingStore struct {
+	err error
+}
+
+func (s failingStore) Create(context.Context, Todo) (*Todo, error) { return nil, s.err }
+func (s failingStore) Upsert(context.Context, Todo, int) (*Todo, bool, error) {
+	return nil, false, s.err
+}
+func (s failingStore) Get(context.Context, int) (*Todo, error)              { return nil, s.err }
+func (s failingStore) List(context.Context, ListOptions) ([]Todo, error)    { return nil, s.err }
+func (s failingStore) Patch(context.Context, TodoPatch, int) (*Todo, error) { return nil, s.err }
+func (s failingStore) PatchFunc(context.Context, int, int, func(Todo) (TodoPatch, error)) (*Todo, error) {
+	return nil, s.err
+}
+func (s failingStore) Delete(context.Context, int, int) error { return s.err }
+func (s failingStore) Batch(context.Context, []BatchOp) ([]BatchResult, error) {
+	return nil, s.err
+}
+func (s failingStore) Restore(context.Context, int, int) (*Todo, error) { return nil, s.err }
+func (s failingStore) Purge(context.Context, time.Time) (int, error)    { return 0, s.err }
+func (s failingStore) History(context.Context, int) ([]HistoryEntry, error) {
+	return nil, s.err
+}
+func (s failingStore) Descendants(context.Context, int) ([]Todo, error) { return nil, s.err }
+func (s failingStore) AddBlocker(context.Context, int, int) error       { return s.err }
+func (s failingStore) RemoveBlocker(context.Context, int, int) error    { return s.err }
+func (s failingStore) Blockers(context.Context, int) ([]Todo, error)    { return nil, s.err }
+func (s failingStore) Next(context.Context, int) ([]Todo, error)        { return nil, s.err }
+func (s failingStore) Tags(context.Context) ([]TagCount, error)         { return nil, s.err }
+func (s failingStore) CreateList(context.Context, List) (*List, error)  { return nil, s.err }
+func (s failingStore) GetList(context.Context, int) (*List, error)      { return nil, s.err }
+func (s failingStore) GetLists(context.Context) ([]List, error)         { return nil, s.err }
+func (s failingStore) UpdateList(context.Context, List) (*List, error)  { return nil, s.err }
+func (s failingStore) DeleteList(context.Context, int, bool) error      { return s.err }
+
+func TestStoreFailure(t *testing.T) {
+	t.Parallel()
+	handler, err := FromConfig(&Config{
+		Store: failingStore{err: errors.New("store is down")},
+		Slog:  slog.New(slog.NewJSONHandler(io.Discard, nil)),
+		RequestIDGenerator: func() string {
+			return "123"
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create handler: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/todos", ""},
+		{http.MethodGet, "/todos/1", ""},
+		{http.MethodPost, "/todos", `{"title": "test"}`},
+		{http.MethodPut, "/todos/1", `{"id": 1, "title": "test"}`},
+		{http.MethodPatch, "/todos/1", `{"id": 1, "description": null}`},
+		{http.MethodDelete, "/todos/1", ""},
+		{http.MethodGet, "/todos/1/history", ""},
+		{http.MethodGet, "/todos/1/children", ""},
+		{http.MethodGet, "/todos/1/children?tree=true", ""},
+		{http.MethodGet, "/todos/1/blockers", ""},
+		{http.MethodPut, "/todos/1/blockers/2", ""},
+		{http.MethodDelete, "/todos/1/blockers/2", ""},
+		{http.MethodGet, "/todos:next", ""},
+		{http.MethodPost, "/todos/1:restore", ""},
+		{http.MethodGet, "/trash", ""},
+		{http.MethodPost, "/todos:batch", `{"ops": [{"op": "delete", "id": 1}]}`},
+		{http.MethodGet, "/tags", ""},
+		{http.MethodGet, "/lists", ""},
+		{http.MethodPost, "/lists", `{"name": "test"}`},
+		{http.MethodGet, "/lists/1", ""},
+		{http.MethodPut, "/lists/1", `{"name": "test"}`},
+		{http.MethodDelete, "/lists/1", ""},
+		{http.MethodGet, "/lists/1/todos", ""},
+		{http.MethodPost, "/lists/1/todos", `{"title": "test"}`},
+	}
+
+	for _, tt := range tests {
+		r, err := http.NewRequestWithContext(context.Background(), tt.method, tt.path, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		r.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		handler.Mux.ServeHTTP(w, r)
+
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("%s %s: expected status code %d, got %d", tt.method, tt.path, http.StatusInternalServerError, w.Code)
+		}
+		if problem := testProblem(t, w); problem.Code != CodeInternal || problem.Detail != "" {
+			t.Fatalf("%s %s: expected problem %s without detail, got %+v", tt.method, tt.path, CodeInternal, problem)
+		}
 	}
 }
@@ -0,0 +1,119 @@
+package todos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// HistoryAction is the kind of change a HistoryEntry records.
+type HistoryAction string
+
+const (
+	HistoryCreate  HistoryAction = "create"
+	HistoryUpdate  HistoryAction = "update"
+	HistoryDelete  HistoryAction = "delete"
+	HistoryRestore HistoryAction = "restore"
+	// HistoryPurge records that a todo was deleted permanently, from the
+	// trash or with its list.
+	HistoryPurge HistoryAction = "purge"
+)
+
+// HistoryEntry records a change of a todo. Changes holds the fields that
+// changed, by their JSON name, and Revision the revision the todo is at after
+// the change, or was at before a purge. Entries are never changed nor deleted,
+// they outlive the todo.
+type HistoryEntry struct {
+	ID        int                    `json:"id"`
+	TodoID    int                    `json:"todo_id"`
+	Action    HistoryAction          `json:"action"`
+	Revision  int                    `json:"revision"`
+	Changes   map[string]FieldChange `json:"changes"`
+	RequestID string                 `json:"request_id"`
+	Caller    string                 `json:"caller"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// FieldChange holds the JSON values of a field before and after a change.
+type FieldChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// historyIgnoredFields change on every write, so they are left out of the
+// changes of an entry.
+var historyIgnoredFields = []string{"revision", "updated_at"}
+
+// newHistoryEntry returns the entry recording that a todo changed from before
+// to after, on behalf of the caller in ctx. before is nil when the todo is
+// created and after is nil when it is purged. The entry is created when after
+// was updated, or at now for a purge.
+func newHistoryEntry(ctx context.Context, action HistoryAction, before, after *Todo, now func() time.Time) (HistoryEntry, error) {
+	entry := HistoryEntry{
+		Action:    action,
+		RequestID: requestIDFrom(ctx),
+		Caller:    callerFrom(ctx),
+	}
+	if after != nil {
+		entry.TodoID, entry.Revision, entry.CreatedAt = after.ID, after.Revision, after.UpdatedAt
+	} else {
+		entry.TodoID, entry.Revision, entry.CreatedAt = before.ID, before.Revision, storeTime(now())
+	}
+
+	beforeFields, err := todoFields(before)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	afterFields, err := todoFields(after)
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+
+	entry.Changes = make(map[string]FieldChange)
+	for _, fields := range []map[string]json.RawMessage{beforeFields, afterFields} {
+		for name := range fields {
+			change := FieldChange{Before: nullIfMissing(beforeFields[name]), After: nullIfMissing(afterFields[name])}
+			if !bytes.Equal(change.Before, change.After) {
+				entry.Changes[name] = change
+			}
+		}
+	}
+	for _, name := range historyIgnoredFields {
+		delete(entry.Changes, name)
+	}
+	return entry, nil
+}
+
+// todoFields returns the JSON fields of todo, none if todo is nil.
+func todoFields(todo *Todo) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if todo == nil {
+		return fields, nil
+	}
+
+	b, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	return fields, json.Unmarshal(b, &fields)
+}
+
+func nullIfMissing(value json.RawMessage) json.RawMessage {
+	if value == nil {
+		return json.RawMessage("null")
+	}
+	return value
+}
+
+// callerFrom returns the identity of the caller in ctx, set from the `X-User`
+// header by withUser.
+func callerFrom(ctx context.Context) string {
+	caller, _ := ctx.Value(xUserHeaderKey).(string)
+	return caller
+}
+
+func requestIDFrom(ctx context.Context) string {
+	requestID, _ := ctx.Value(xRequestIDHeaderKey).(string)
+	return requestID
+}
@@ -0,0 +1,354 @@
+package todos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// JSONPatchOp is an operation of a JSON Patch (RFC 6902). Value is nil when
+// the operation carries no value, and `null` when it carries null.
+type JSONPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+var jsonPatchOps = []string{"add", "remove", "replace", "move", "copy", "test"}
+
+// jsonPatchFields are the fields of a todo a JSON Patch may change, the other
+// fields of a todo may only be tested.
+var jsonPatchFields = []string{"title", "description", "completed", "priority", "list_id", "parent_id", "due_at", "tags"}
+
+// ErrJSONPatchTestFailed is returned when the test operation at Index of a
+// JSON Patch finds another value at Path.
+type ErrJSONPatchTestFailed struct {
+	Index int
+	Path  string
+}
+
+func (e ErrJSONPatchTestFailed) Error() string {
+	return fmt.Sprintf("op `%d`: test of `%s` failed", e.Index, e.Path)
+}
+
+// ErrJSONPatchFailed is returned when the operation at Index of a JSON Patch
+// cannot be applied to the todo, such as the removal of a missing value.
+type ErrJSONPatchFailed struct {
+	Index  int
+	Reason string
+}
+
+func (e ErrJSONPatchFailed) Error() string {
+	return fmt.Sprintf("op `%d`: %s", e.Index, e.Reason)
+}
+
+// errJSONPatchTest is returned by apply when a test operation fails.
+var errJSONPatchTest = errors.New("test failed")
+
+// validateJSONPatchOp checks op, found at prefix in the body: its kind, its
+// pointers and that it only changes the fields of jsonPatchFields.
+func validateJSONPatchOp(v *validator, prefix string, op JSONPatchOp) {
+	if !slices.Contains(jsonPatchOps, op.Op) {
+		v.add(prefix+"op", CodeInvalid, fmt.Sprintf("invalid op: `%s`, try: [%s]", op.Op, strings.Join(jsonPatchOps, ", ")))
+		return
+	}
+
+	changed := op.Op != "test"
+	v.jsonPointer(prefix+"path", op.Path, changed)
+	switch op.Op {
+	case "move", "copy":
+		if op.From == "" {
+			v.add(prefix+"from", CodeRequired, "must not be empty")
+		} else {
+			v.jsonPointer(prefix+"from", op.From, op.Op == "move")
+		}
+	case "add", "replace", "test":
+		if op.Value == nil {
+			v.add(prefix+"value", CodeRequired, "must be set")
+		}
+	}
+}
+
+// jsonPointer checks that pointer is a JSON Pointer (RFC 6901) to a field of a
+// todo, and to a field a patch may change if changed.
+func (v *validator) jsonPointer(field, pointer string, changed bool) {
+	tokens, err := parseJSONPointer(pointer)
+	switch {
+	case err != nil:
+		v.add(field, CodeInvalid, err.Error())
+	case len(tokens) == 0:
+		v.add(field, CodeNotAllowed, "must point to a field of the todo, not the whole todo")
+	case !slices.Contains(jsonFields(reflect.TypeOf(Todo{})), tokens[0]):
+		v.add(field, CodeInvalid, fmt.Sprintf("unknown field `%s`", tokens[0]))
+	case changed && !slices.Contains(jsonPatchFields, tokens[0]):
+		v.add(field, CodeNotAllowed, fmt.Sprintf("field `%s` is read only", tokens[0]))
+	}
+}
+
+// applyJSONPatch applies ops to todo in order and returns the patch of the
+// fields they changed. A field the ops remove is reset as if set to null by
+// a merge patch.
+func applyJSONPatch(todo Todo, ops []JSONPatchOp) (TodoPatch, error) {
+	raw, err := json.Marshal(todo)
+	if err != nil {
+		return TodoPatch{}, err
+	}
+	var before, doc map[string]any
+	if err := json.Unmarshal(raw, &before); err != nil {
+		return TodoPatch{}, err
+	}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return TodoPatch{}, err
+	}
+
+	var patched any = doc
+	for i, op := range ops {
+		if patched, err = op.apply(patched); err != nil {
+			if errors.Is(err, errJSONPatchTest) {
+				return TodoPatch{}, ErrJSONPatchTestFailed{Index: i, Path: op.Path}
+			}
+			return TodoPatch{}, ErrJSONPatchFailed{Index: i, Reason: err.Error()}
+		}
+	}
+
+	// The ops only change fields of the todo, so patched is still an object.
+	changes := make(map[string]any)
+	for _, field := range jsonPatchFields {
+		if value := patched.(map[string]any)[field]; !reflect.DeepEqual(value, before[field]) {
+			changes[field] = value
+		}
+	}
+
+	raw, err = json.Marshal(changes)
+	if err != nil {
+		return TodoPatch{}, err
+	}
+	patch := NewTodoPatch()
+	if err := json.Unmarshal(raw, &patch); err != nil {
+		return TodoPatch{}, err
+	}
+
+	var v validator
+	validateTodoPatch(&v, "", patch)
+	return patch, v.err()
+}
+
+// apply returns doc with op applied, doc may be changed in place.
+func (op JSONPatchOp) apply(doc any) (any, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	if op.Value != nil {
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return jsonAdd(doc, path, value)
+	case "remove":
+		doc, _, err := jsonRemove(doc, path)
+		return doc, err
+	case "replace":
+		doc, _, err := jsonRemove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return jsonAdd(doc, path, value)
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			value, err := jsonGet(doc, from)
+			if err != nil {
+				return nil, err
+			}
+			return jsonAdd(doc, path, jsonCopy(value))
+		}
+
+		if len(from) < len(path) && slices.Equal(from, path[:len(from)]) {
+			return nil, fmt.Errorf("cannot move `%s` into itself", op.From)
+		}
+		doc, value, err := jsonRemove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return jsonAdd(doc, path, value)
+	case "test":
+		current, err := jsonGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, errJSONPatchTest
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("invalid op: `%s`", op.Op)
+	}
+}
+
+// parseJSONPointer splits a JSON Pointer (RFC 6901) into its unescaped
+// tokens, none for the pointer to the whole document.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer: `%s`, it must start with `/`", pointer)
+	}
+
+	unescape := strings.NewReplacer("~1", "/", "~0", "~")
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = unescape.Replace(token)
+	}
+	return tokens, nil
+}
+
+// jsonGet returns the value at path in doc.
+func jsonGet(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("no value at `%s`", token)
+			}
+			doc = value
+		case []any:
+			i, err := jsonIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("no value at `%s`", token)
+		}
+	}
+	return doc, nil
+}
+
+// jsonAdd returns doc with value added at path: set in an object, inserted in
+// an array, or appended for the index `-`.
+func jsonAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	token, rest := path[0], path[1:]
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(rest) == 0 {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("no value at `%s`", token)
+		}
+		child, err := jsonAdd(child, rest, value)
+		node[token] = child
+		return node, err
+	case []any:
+		if len(rest) == 0 {
+			i := len(node)
+			if token != "-" {
+				var err error
+				if i, err = jsonIndex(token, len(node)); err != nil {
+					return nil, err
+				}
+			}
+			return slices.Insert(node, i, value), nil
+		}
+		i, err := jsonIndex(token, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		node[i], err = jsonAdd(node[i], rest, value)
+		return node, err
+	default:
+		return nil, fmt.Errorf("no value at `%s`", token)
+	}
+}
+
+// jsonRemove returns doc without the value at path, and the value.
+func jsonRemove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+
+	token, rest := path[0], path[1:]
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("no value at `%s`", token)
+		}
+		if len(rest) == 0 {
+			delete(node, token)
+			return node, child, nil
+		}
+		child, removed, err := jsonRemove(child, rest)
+		node[token] = child
+		return node, removed, err
+	case []any:
+		i, err := jsonIndex(token, len(node)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := node[i]
+			return slices.Delete(node, i, i+1), removed, nil
+		}
+		child, removed, err := jsonRemove(node[i], rest)
+		node[i] = child
+		return node, removed, err
+	default:
+		return nil, nil, fmt.Errorf("no value at `%s`", token)
+	}
+}
+
+// jsonIndex parses the array index token, which must be at most last.
+func jsonIndex(token string, last int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || strconv.Itoa(i) != token {
+		return 0, fmt.Errorf("invalid array index: `%s`", token)
+	}
+	if i > last {
+		return 0, fmt.Errorf("array index `%d` out of range", i)
+	}
+	return i, nil
+}
+
+// jsonCopy returns a deep copy of the decoded JSON value, so that a copied
+// value is not changed along with the original.
+func jsonCopy(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(value))
+		for key, v := range value {
+			copied[key] = jsonCopy(v)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(value))
+		for i, v := range value {
+			copied[i] = jsonCopy(v)
+		}
+		return copied
+	default:
+		return value
+	}
+}
@@ -0,0 +1,125 @@
+package todos
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	t.Parallel()
+
+	due := time.Date(2024, 11, 1, 9, 30, 0, 0, time.UTC)
+	todo := Todo{ID: 1, Title: "first", Description: "details", Priority: PriorityNormal, ListID: ptr(2), DueAt: &due, Tags: []string{"api", "backend"}, Revision: 3}
+
+	tests := []struct {
+		name string
+		ops  string
+		want TodoPatch
+	}{
+		{"replace", `[{"op": "replace", "path": "/title", "value": "renamed"}]`, TodoPatch{Title: ptr("renamed")}},
+		{"test then replace", `[{"op": "test", "path": "/title", "value": "first"}, {"op": "replace", "path": "/completed", "value": true}]`, TodoPatch{Completed: ptr(true)}},
+		{"test read only field", `[{"op": "test", "path": "/revision", "value": 3}, {"op": "replace", "path": "/priority", "value": "high"}]`, TodoPatch{Priority: ptr(PriorityHigh)}},
+		{"add tag", `[{"op": "add", "path": "/tags/-", "value": "urgent"}]`, TodoPatch{Tags: &[]string{"api", "backend", "urgent"}}},
+		{"insert tag", `[{"op": "add", "path": "/tags/0", "value": "urgent"}]`, TodoPatch{Tags: &[]string{"urgent", "api", "backend"}}},
+		{"remove tag", `[{"op": "remove", "path": "/tags/1"}]`, TodoPatch{Tags: &[]string{"api"}}},
+		{"remove due date", `[{"op": "remove", "path": "/due_at"}]`, TodoPatch{DueAt: &time.Time{}}},
+		{"replace with null", `[{"op": "replace", "path": "/list_id", "value": null}]`, TodoPatch{ListID: ptr(0)}},
+		{"add over a field", `[{"op": "add", "path": "/parent_id", "value": 4}]`, TodoPatch{ParentID: ptr(4)}},
+		{"copy", `[{"op": "copy", "from": "/title", "path": "/description"}]`, TodoPatch{Description: ptr("first")}},
+		{"copy a tag", `[{"op": "copy", "from": "/tags/0", "path": "/tags/-"}]`, TodoPatch{Tags: &[]string{"api", "backend", "api"}}},
+		{"move", `[{"op": "move", "from": "/tags/0", "path": "/tags/1"}]`, TodoPatch{Tags: &[]string{"backend", "api"}}},
+		{"move a field", `[{"op": "move", "from": "/description", "path": "/title"}]`, TodoPatch{Title: ptr("details"), Description: ptr("")}},
+		{"unchanged", `[{"op": "replace", "path": "/title", "value": "first"}]`, TodoPatch{}},
+		{"in order", `[{"op": "replace", "path": "/title", "value": "a"}, {"op": "test", "path": "/title", "value": "a"}, {"op": "replace", "path": "/title", "value": "b"}]`, TodoPatch{Title: ptr("b")}},
+	}
+	for _, tt := range tests {
+		var ops []JSONPatchOp
+		if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+			t.Fatalf("%s: failed to unmarshal ops: %v", tt.name, err)
+		}
+
+		patch, err := applyJSONPatch(todo, ops)
+		if err != nil {
+			t.Fatalf("%s: failed to apply patch: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(patch, tt.want) {
+			t.Fatalf("%s: expected patch %+v, got %+v", tt.name, tt.want, patch)
+		}
+	}
+
+	if !reflect.DeepEqual(todo.Tags, []string{"api", "backend"}) {
+		t.Fatalf("expected the todo unchanged, got tags %v", todo.Tags)
+	}
+}
+
+func TestApplyJSONPatchFails(t *testing.T) {
+	t.Parallel()
+
+	todo := Todo{ID: 1, Title: "first", Priority: PriorityNormal, Tags: []string{"api"}, Revision: 3}
+
+	tests := []struct {
+		name string
+		ops  string
+		want error
+	}{
+		{"test fails", `[{"op": "test", "path": "/title", "value": "other"}]`, ErrJSONPatchTestFailed{Index: 0, Path: "/title"}},
+		{"test of number type", `[{"op": "test", "path": "/revision", "value": "3"}]`, ErrJSONPatchTestFailed{Index: 0, Path: "/revision"}},
+		{"later test fails", `[{"op": "replace", "path": "/title", "value": "a"}, {"op": "test", "path": "/title", "value": "first"}]`, ErrJSONPatchTestFailed{Index: 1, Path: "/title"}},
+		{"remove missing", `[{"op": "remove", "path": "/tags/1"}]`, ErrJSONPatchFailed{}},
+		{"index out of range", `[{"op": "add", "path": "/tags/2", "value": "x"}]`, ErrJSONPatchFailed{}},
+		{"index with leading zero", `[{"op": "replace", "path": "/tags/00", "value": "x"}]`, ErrJSONPatchFailed{}},
+		{"into a string", `[{"op": "add", "path": "/title/x", "value": "x"}]`, ErrJSONPatchFailed{}},
+		{"move into itself", `[{"op": "move", "from": "/tags", "path": "/tags/0"}]`, ErrJSONPatchFailed{}},
+		{"wrong type", `[{"op": "replace", "path": "/completed", "value": "yes"}]`, ErrInvalidFields{}},
+		{"removed title", `[{"op": "remove", "path": "/title"}]`, ErrInvalidFields{}},
+	}
+	for _, tt := range tests {
+		var ops []JSONPatchOp
+		if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+			t.Fatalf("%s: failed to unmarshal ops: %v", tt.name, err)
+		}
+
+		_, err := applyJSONPatch(todo, ops)
+		switch want := tt.want.(type) {
+		case ErrJSONPatchTestFailed:
+			if !errors.Is(err, want) {
+				t.Fatalf("%s: expected %v, got %v", tt.name, want, err)
+			}
+		case ErrJSONPatchFailed:
+			if !errors.As(err, new(ErrJSONPatchFailed)) {
+				t.Fatalf("%s: expected ErrJSONPatchFailed, got %v", tt.name, err)
+			}
+		case ErrInvalidFields:
+			if !errors.As(err, new(ErrInvalidFields)) {
+				t.Fatalf("%s: expected ErrInvalidFields, got %v", tt.name, err)
+			}
+		}
+	}
+}
+
+func TestParseJSONPointer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pointer string
+		want    []string
+	}{
+		{"", nil},
+		{"/", []string{""}},
+		{"/tags/0", []string{"tags", "0"}},
+		{"/a~1b/c~0d/~01", []string{"a/b", "c~d", "~1"}},
+	}
+	for _, tt := range tests {
+		got, err := parseJSONPointer(tt.pointer)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("%q: expected %q, got %q, %v", tt.pointer, tt.want, got, err)
+		}
+	}
+
+	if _, err := parseJSONPointer("tags"); err == nil {
+		t.Fatalf("expected a pointer without a leading `/` to be rejected")
+	}
+}
@@ -0,0 +1,240 @@
+package todos
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListLimit is the page size used when a listing sets no limit.
+	DefaultListLimit = 100
+	// MaxListLimit is the largest page size a listing may ask for.
+	MaxListLimit = 1000
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListOptions selects a page of todos.
+type ListOptions struct {
+	// Limit is the maximum number of todos in the page.
+	Limit int
+	// After starts the page right after the todo the cursor points to. A nil
+	// cursor starts at the first todo. The cursor must come from a listing
+	// with the same Sort.
+	After *Cursor
+	// Completed keeps only the todos with the given completed state.
+	Completed *bool
+	// Query keeps only the todos whose title or description contains it,
+	// ignoring case.
+	Query string
+	// CreatedAt, UpdatedAt and CompletedAt keep only the todos with the
+	// matching timestamp in range. Todos that are not completed have no
+	// completion timestamp, so they never match a bounded CompletedAt.
+	CreatedAt   TimeRange
+	UpdatedAt   TimeRange
+	CompletedAt TimeRange
+	// DueAt keeps only the todos due in range. Todos without a due date never
+	// match a bounded DueAt.
+	DueAt TimeRange
+	// Overdue keeps only the todos that are, or are not, overdue: not
+	// completed and due before the current time of the store.
+	Overdue *bool
+	// ListID keeps only the todos in the list.
+	ListID *int
+	// ParentID keeps only the children of the todo.
+	ParentID *int
+	// Blocked keeps only the todos that are, or are not, blocked by an open
+	// todo.
+	Blocked *bool
+	// Tags keeps only the todos tagged with any of the tags, or with all of
+	// them if AllTags is set.
+	Tags    []string
+	AllTags bool
+	// Trashed lists the todos in the trash instead of the others.
+	Trashed bool
+	// Sort orders the todos, ID ascending by default.
+	Sort Sort
+}
+
+// TimeRange matches the times at or after After and before Before. A nil
+// bound leaves that side of the range open.
+type TimeRange struct {
+	After  *time.Time
+	Before *time.Time
+}
+
+func (r TimeRange) contains(t *time.Time) bool {
+	if r.After == nil && r.Before == nil {
+		return true
+	}
+	if t == nil {
+		return false
+	}
+	if r.After != nil && t.Before(*r.After) {
+		return false
+	}
+	if r.Before != nil && !t.Before(*r.Before) {
+		return false
+	}
+	return true
+}
+
+// match reports whether todo belongs in the listing at now, ignoring Limit and
+// Blocked, which depends on other todos.
+func (o ListOptions) match(todo Todo, now time.Time) bool {
+	if (todo.DeletedAt != nil) != o.Trashed {
+		return false
+	}
+
+	if o.Completed != nil && todo.Completed != *o.Completed {
+		return false
+	}
+
+	if o.Query != "" && !containsFold(todo.Title, o.Query) && !containsFold(todo.Description, o.Query) {
+		return false
+	}
+
+	if !o.CreatedAt.contains(&todo.CreatedAt) || !o.UpdatedAt.contains(&todo.UpdatedAt) || !o.CompletedAt.contains(todo.CompletedAt) || !o.DueAt.contains(todo.DueAt) {
+		return false
+	}
+
+	if o.Overdue != nil && todo.overdue(now) != *o.Overdue {
+		return false
+	}
+
+	if o.ListID != nil && (todo.ListID == nil || *todo.ListID != *o.ListID) {
+		return false
+	}
+
+	if o.ParentID != nil && (todo.ParentID == nil || *todo.ParentID != *o.ParentID) {
+		return false
+	}
+
+	if len(o.Tags) > 0 {
+		tagged := func(tag string) bool { return slices.Contains(todo.Tags, tag) }
+		if o.AllTags && !all(o.Tags, tagged) || !o.AllTags && !slices.ContainsFunc(o.Tags, tagged) {
+			return false
+		}
+	}
+
+	if o.After != nil && !o.Sort.less(o.After.todo(), todo) {
+		return false
+	}
+
+	return true
+}
+
+func all[T any](s []T, f func(T) bool) bool {
+	return !slices.ContainsFunc(s, func(v T) bool { return !f(v) })
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+type SortField string
+
+const (
+	SortByID       SortField = "id"
+	SortByTitle    SortField = "title"
+	SortByPriority SortField = "priority"
+)
+
+// Sort orders a listing by Field, then by ID in the same direction so that
+// every todo has a stable position.
+type Sort struct {
+	Field SortField
+	Desc  bool
+}
+
+// ParseSort parses a field name, prefixed with `-` for descending order.
+func ParseSort(raw string) (Sort, error) {
+	field, desc := strings.CutPrefix(raw, "-")
+	switch SortField(field) {
+	case SortByID, SortByTitle, SortByPriority:
+		return Sort{Field: SortField(field), Desc: desc}, nil
+	default:
+		return Sort{}, fmt.Errorf("invalid sort: `%s`, try: [id, -id, title, -title, priority, -priority]", raw)
+	}
+}
+
+func (s Sort) String() string {
+	field := s.Field
+	if field == "" {
+		field = SortByID
+	}
+	if s.Desc {
+		return "-" + string(field)
+	}
+	return string(field)
+}
+
+// less reports whether a comes before b.
+func (s Sort) less(a, b Todo) bool {
+	var c int
+	switch s.Field {
+	case SortByTitle:
+		c = strings.Compare(a.Title, b.Title)
+	case SortByPriority:
+		c = cmp.Compare(a.Priority.rank(), b.Priority.rank())
+	}
+	if c == 0 {
+		c = cmp.Compare(a.ID, b.ID)
+	}
+	if s.Desc {
+		c = -c
+	}
+	return c < 0
+}
+
+// Cursor points to the last todo of a page. Pages are keyset based, so todos
+// created or deleted between two requests never shift the next page.
+type Cursor struct {
+	Sort     string   `json:"sort"`
+	ID       int      `json:"id"`
+	Title    string   `json:"title,omitempty"`
+	Priority Priority `json:"priority,omitempty"`
+}
+
+// CursorOf returns the cursor that points to todo in a listing sorted by s.
+func CursorOf(s Sort, todo Todo) *Cursor {
+	cursor := &Cursor{Sort: s.String(), ID: todo.ID}
+	switch s.Field {
+	case SortByTitle:
+		cursor.Title = todo.Title
+	case SortByPriority:
+		cursor.Priority = todo.Priority
+	}
+	return cursor
+}
+
+// todo returns a todo with the sort keys of the cursor.
+func (c *Cursor) todo() Todo {
+	return Todo{ID: c.ID, Title: c.Title, Priority: c.Priority}
+}
+
+// Encode returns the cursor as an opaque string for clients.
+func (c *Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor returned by Encode.
+func DecodeCursor(raw string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,131 @@
+package todos
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	t.Parallel()
+
+	want := CursorOf(Sort{Field: SortByTitle, Desc: true}, exampleTodo())
+	got, err := DecodeCursor(want.Encode())
+	if err != nil {
+		t.Fatalf("failed to decode cursor: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected cursor %v, got %v", want, got)
+	}
+
+	want = CursorOf(Sort{Field: SortByPriority}, Todo{ID: 2, Priority: PriorityUrgent})
+	got, err = DecodeCursor(want.Encode())
+	if err != nil {
+		t.Fatalf("failed to decode cursor: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected cursor %v, got %v", want, got)
+	}
+
+	for _, raw := range []string{"!", "bm90IGpzb24"} {
+		if _, err := DecodeCursor(raw); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("%s: expected error to be ErrInvalidCursor, got %v", raw, err)
+		}
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw  string
+		want Sort
+	}{
+		{"id", Sort{Field: SortByID}},
+		{"-id", Sort{Field: SortByID, Desc: true}},
+		{"title", Sort{Field: SortByTitle}},
+		{"-title", Sort{Field: SortByTitle, Desc: true}},
+		{"priority", Sort{Field: SortByPriority}},
+		{"-priority", Sort{Field: SortByPriority, Desc: true}},
+	}
+	for _, tt := range tests {
+		got, err := ParseSort(tt.raw)
+		if err != nil {
+			t.Fatalf("%s: failed to parse sort: %v", tt.raw, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: expected sort %v, got %v", tt.raw, tt.want, got)
+		}
+		if got.String() != tt.raw {
+			t.Fatalf("expected sort string %s, got %s", tt.raw, got.String())
+		}
+	}
+
+	if _, err := ParseSort("description"); err == nil {
+		t.Fatalf("expected invalid sort error")
+	}
+}
+
+// testListOptions checks the filters, sorting and paging of a store's List.
+// Both store implementations must pass it.
+func testListOptions(t *testing.T, store Store) {
+	for _, todo := range []Todo{
+		{ID: 1, Title: "b", Description: "Buy milk", Completed: true, Priority: PriorityHigh},
+		{ID: 2, Title: "a", Description: "100% done"},
+		{ID: 3, Title: "b", Description: "Ärger with the dog", Priority: PriorityUrgent},
+		{ID: 4, Title: "c", Description: "MILK again", Completed: true, Priority: PriorityHigh},
+	} {
+		if _, _, err := store.Upsert(context.Background(), todo, NoRevision); err != nil {
+			t.Fatalf("failed to insert todo: %v", err)
+		}
+	}
+
+	completed := true
+	notCompleted := false
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []int
+	}{
+		{"default", ListOptions{}, []int{1, 2, 3, 4}},
+		{"completed", ListOptions{Completed: &completed}, []int{1, 4}},
+		{"not completed", ListOptions{Completed: &notCompleted}, []int{2, 3}},
+		{"query ignores case", ListOptions{Query: "milk"}, []int{1, 4}},
+		{"query matches wildcards literally", ListOptions{Query: "0%"}, []int{2}},
+		{"query matches title", ListOptions{Query: "C"}, []int{4}},
+		{"query ignores case beyond ASCII", ListOptions{Query: "äRGER"}, []int{3}},
+		{"id descending", ListOptions{Sort: Sort{Field: SortByID, Desc: true}}, []int{4, 3, 2, 1}},
+		{"title", ListOptions{Sort: Sort{Field: SortByTitle}}, []int{2, 1, 3, 4}},
+		{"title descending", ListOptions{Sort: Sort{Field: SortByTitle, Desc: true}}, []int{4, 3, 1, 2}},
+		{"priority", ListOptions{Sort: Sort{Field: SortByPriority}}, []int{2, 1, 4, 3}},
+		{"priority descending", ListOptions{Sort: Sort{Field: SortByPriority, Desc: true}}, []int{3, 4, 1, 2}},
+		{"filter and sort", ListOptions{Completed: &completed, Sort: Sort{Field: SortByID, Desc: true}}, []int{4, 1}},
+	}
+
+	for _, tt := range tests {
+		for _, limit := range []int{1, 2, MaxListLimit} {
+			opts := tt.opts
+			opts.Limit = limit
+
+			var got []int
+			for {
+				todos, err := store.List(context.Background(), opts)
+				if err != nil {
+					t.Fatalf("%s: failed to list todos: %v", tt.name, err)
+				}
+				for _, todo := range todos {
+					got = append(got, todo.ID)
+				}
+				if len(todos) < limit {
+					break
+				}
+				opts.After = CursorOf(opts.Sort, todos[len(todos)-1])
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("%s with limit %d: expected ids %v, got %v", tt.name, limit, tt.want, got)
+			}
+		}
+	}
+}
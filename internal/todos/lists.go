@@ -0,0 +1,43 @@
+package todos
+
+import (
+	"fmt"
+	"time"
+)
+
+// List groups todos, for example the todos of one team. Todos without a list
+// are not part of any.
+type List struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ErrListNotFound struct {
+	ID int
+}
+
+func (e ErrListNotFound) Error() string {
+	return fmt.Sprintf("list `%d` not found", e.ID)
+}
+
+// ErrListNotEmpty is returned when deleting a list that still has todos
+// without cascading to them.
+type ErrListNotEmpty struct {
+	ID int
+}
+
+func (e ErrListNotEmpty) Error() string {
+	return fmt.Sprintf("list `%d` still has todos, delete them first or cascade", e.ID)
+}
+
+// ErrUnknownList is returned when a todo is written with a list that does not
+// exist.
+type ErrUnknownList struct {
+	ID int
+}
+
+func (e ErrUnknownList) Error() string {
+	return fmt.Sprintf("list `%d` does not exist", e.ID)
+}
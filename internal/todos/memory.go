@@ -0,0 +1,780 @@
+package todos
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that keeps todos in memory. It is safe for
+// concurrent use and loses every todo when the process exits.
+type MemoryStore struct {
+	now    func() time.Time
+	mu     sync.RWMutex
+	todos  map[int]Todo
+	lastID int
+	// blockers holds the IDs of the todos blocking each todo.
+	blockers   map[int]map[int]bool
+	lists      map[int]List
+	lastListID int
+	// history holds the history entries of every todo, oldest first.
+	history []HistoryEntry
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{now: time.Now, todos: make(map[int]Todo), blockers: make(map[int]map[int]bool), lists: make(map[int]List)}
+}
+
+func (m *MemoryStore) Create(ctx context.Context, todo Todo) (*Todo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkList(todo.ListID); err != nil {
+		return nil, err
+	}
+
+	if err := m.checkParent(m.lastID+1, todo.ParentID); err != nil {
+		return nil, err
+	}
+
+	todo.ID = m.lastID + 1
+	todo.Revision = 1
+	todo.touch(nil, storeTime(m.now()))
+	if err := m.checkParentOpen(nil, todo); err != nil {
+		return nil, err
+	}
+	if err := m.recordHistory(ctx, HistoryCreate, nil, &todo); err != nil {
+		return nil, err
+	}
+
+	m.todos[todo.ID] = todo
+	m.lastID = todo.ID
+	return &todo, nil
+}
+
+func (m *MemoryStore) Upsert(ctx context.Context, todo Todo, revision int) (*Todo, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.upsert(ctx, todo, revision)
+}
+
+// upsert is Upsert, the caller must hold m.mu.
+func (m *MemoryStore) upsert(ctx context.Context, todo Todo, revision int) (*Todo, bool, error) {
+	previous, exists := m.todos[todo.ID]
+	if exists && previous.DeletedAt != nil {
+		return nil, false, ErrTrashed{ID: todo.ID}
+	}
+
+	if err := checkRevision(todo.ID, previous.Revision, revision); err != nil {
+		return nil, false, err
+	}
+
+	if !exists && slices.ContainsFunc(m.history, func(entry HistoryEntry) bool { return entry.TodoID == todo.ID }) {
+		return nil, false, ErrPurged{ID: todo.ID}
+	}
+
+	if err := m.checkList(todo.ListID); err != nil {
+		return nil, false, err
+	}
+
+	if err := m.checkParent(todo.ID, todo.ParentID); err != nil {
+		return nil, false, err
+	}
+
+	if exists && todo.Completed && !previous.Completed {
+		if err := m.checkChildrenCompleted(todo.ID); err != nil {
+			return nil, false, err
+		}
+		if m.blocked(todo.ID) {
+			return nil, false, ErrOpenBlockers{ID: todo.ID}
+		}
+	}
+
+	todo.Revision = previous.Revision + 1
+	action, before := HistoryCreate, (*Todo)(nil)
+	if exists {
+		action, before = HistoryUpdate, &previous
+	}
+	todo.touch(before, storeTime(m.now()))
+	if err := m.checkParentOpen(before, todo); err != nil {
+		return nil, false, err
+	}
+	if err := m.recordHistory(ctx, action, before, &todo); err != nil {
+		return nil, false, err
+	}
+
+	m.todos[todo.ID] = todo
+	m.lastID = max(m.lastID, todo.ID)
+	return &todo, !exists, nil
+}
+
+func (m *MemoryStore) Delete(ctx context.Context, id int, revision int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.delete(ctx, id, revision)
+}
+
+// delete is Delete, the caller must hold m.mu.
+func (m *MemoryStore) delete(ctx context.Context, id int, revision int) error {
+	todo, ok := m.get(id)
+	if !ok {
+		return ErrNotFound{ID: id}
+	}
+
+	if err := checkRevision(id, todo.Revision, revision); err != nil {
+		return err
+	}
+
+	for _, child := range m.todos {
+		if child.ParentID != nil && *child.ParentID == id && child.DeletedAt == nil {
+			return ErrHasChildren{ID: id}
+		}
+	}
+
+	previous := todo
+	now := storeTime(m.now())
+	todo.Revision++
+	todo.UpdatedAt = now
+	todo.DeletedAt = &now
+	if err := m.recordHistory(ctx, HistoryDelete, &previous, &todo); err != nil {
+		return err
+	}
+
+	m.todos[id] = todo
+	return nil
+}
+
+func (m *MemoryStore) Restore(ctx context.Context, id int, revision int) (*Todo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	todo, ok := m.todos[id]
+	if !ok {
+		return nil, ErrNotFound{ID: id}
+	}
+
+	if todo.DeletedAt == nil {
+		return nil, ErrNotTrashed{ID: id}
+	}
+
+	if err := checkRevision(id, todo.Revision, revision); err != nil {
+		return nil, err
+	}
+
+	if todo.ParentID != nil && m.todos[*todo.ParentID].DeletedAt != nil {
+		return nil, ErrTrashed{ID: *todo.ParentID}
+	}
+
+	previous := todo
+	todo.Revision++
+	todo.UpdatedAt = storeTime(m.now())
+	todo.DeletedAt = nil
+	if err := m.recordHistory(ctx, HistoryRestore, &previous, &todo); err != nil {
+		return nil, err
+	}
+
+	m.todos[id] = todo
+	return &todo, nil
+}
+
+func (m *MemoryStore) Purge(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var ids []int
+	for id, todo := range m.todos {
+		if todo.DeletedAt != nil && todo.DeletedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+
+	return len(ids), m.purge(ctx, ids)
+}
+
+// purge permanently deletes the todos with the given ids and records it in
+// their history. The caller must hold m.mu.
+func (m *MemoryStore) purge(ctx context.Context, ids []int) error {
+	sort.Ints(ids)
+	for _, id := range ids {
+		todo := m.todos[id]
+		if err := m.recordHistory(ctx, HistoryPurge, &todo, nil); err != nil {
+			return err
+		}
+		m.deleteTodo(id)
+	}
+	return nil
+}
+
+// detachTrashed applies detach to the todos in the trash that match, so that
+// they can still be restored once the list or parent they point to is gone.
+// The caller must hold m.mu.
+func (m *MemoryStore) detachTrashed(ctx context.Context, match func(Todo) bool, detach func(*Todo)) error {
+	var ids []int
+	for id, todo := range m.todos {
+		if todo.DeletedAt != nil && match(todo) {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Ints(ids)
+	now := storeTime(m.now())
+	for _, id := range ids {
+		previous := m.todos[id]
+		todo := previous
+		detach(&todo)
+		todo.Revision++
+		todo.UpdatedAt = now
+		if err := m.recordHistory(ctx, HistoryUpdate, &previous, &todo); err != nil {
+			return err
+		}
+		m.todos[id] = todo
+	}
+	return nil
+}
+
+func (m *MemoryStore) History(_ context.Context, id int) ([]HistoryEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := []HistoryEntry{}
+	for _, entry := range m.history {
+		if entry.TodoID == id {
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrNotFound{ID: id}
+	}
+	return entries, nil
+}
+
+// recordHistory records in the history of a todo that it changed from before
+// to after. The caller must hold m.mu.
+func (m *MemoryStore) recordHistory(ctx context.Context, action HistoryAction, before, after *Todo) error {
+	entry, err := newHistoryEntry(ctx, action, before, after, m.now)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = len(m.history) + 1
+	m.history = append(m.history, entry)
+	return nil
+}
+
+func (m *MemoryStore) Get(_ context.Context, id int) (*Todo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	todo, ok := m.get(id)
+	if !ok {
+		return nil, ErrNotFound{ID: id}
+	}
+	return &todo, nil
+}
+
+func (m *MemoryStore) List(_ context.Context, opts ListOptions) ([]Todo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	all := make([]Todo, 0, len(m.todos))
+	for _, todo := range m.todos {
+		all = append(all, todo)
+	}
+	sort.Slice(all, func(i, j int) bool { return opts.Sort.less(all[i], all[j]) })
+
+	now := storeTime(m.now())
+	opts.Tags = normalizeTags(opts.Tags)
+	todos := make([]Todo, 0, opts.Limit)
+	for _, todo := range all {
+		if len(todos) == opts.Limit {
+			break
+		}
+		if opts.Blocked != nil && m.blocked(todo.ID) != *opts.Blocked {
+			continue
+		}
+		if opts.match(todo, now) {
+			todos = append(todos, todo)
+		}
+	}
+
+	return todos, nil
+}
+
+func (m *MemoryStore) Patch(ctx context.Context, patch TodoPatch, revision int) (*Todo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.patch(ctx, patch, revision)
+}
+
+func (m *MemoryStore) PatchFunc(ctx context.Context, id int, revision int, fn func(Todo) (TodoPatch, error)) (*Todo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.get(id)
+	if !ok {
+		return nil, ErrNotFound{ID: id}
+	}
+
+	if err := checkRevision(id, current.Revision, revision); err != nil {
+		return nil, err
+	}
+
+	patch, err := fn(current)
+	if err != nil {
+		return nil, err
+	}
+	if patch.empty() {
+		return &current, nil
+	}
+	patch.ID = id
+
+	return m.patch(ctx, patch, revision)
+}
+
+// patch is Patch, the caller must hold m.mu.
+func (m *MemoryStore) patch(ctx context.Context, patch TodoPatch, revision int) (*Todo, error) {
+	if patch.empty() {
+		return nil, ErrNoFieldsToUpdate
+	}
+
+	todo, ok := m.get(patch.ID)
+	if !ok {
+		return nil, ErrNotFound{ID: patch.ID}
+	}
+
+	if err := checkRevision(patch.ID, todo.Revision, revision); err != nil {
+		return nil, err
+	}
+
+	if err := m.checkList(patch.ListID); err != nil {
+		return nil, err
+	}
+
+	if err := m.checkParent(patch.ID, patch.ParentID); err != nil {
+		return nil, err
+	}
+
+	if patch.Completed != nil && *patch.Completed && !todo.Completed {
+		if err := m.checkChildrenCompleted(patch.ID); err != nil {
+			return nil, err
+		}
+		if m.blocked(patch.ID) {
+			return nil, ErrOpenBlockers{ID: patch.ID}
+		}
+	}
+
+	previous := todo
+	if patch.Title != nil {
+		todo.Title = *patch.Title
+	}
+	if patch.Description != nil {
+		todo.Description = *patch.Description
+	}
+	if patch.Completed != nil {
+		todo.Completed = *patch.Completed
+	}
+	if patch.Priority != nil {
+		todo.Priority = *patch.Priority
+	}
+	if patch.ListID != nil {
+		todo.ListID = patch.ListID
+	}
+	if patch.ParentID != nil {
+		todo.ParentID = patch.ParentID
+	}
+	if patch.DueAt != nil {
+		todo.DueAt = patch.DueAt
+	}
+	if patch.changesTags() {
+		todo.Tags = patch.tags(todo.Tags)
+	}
+	todo.Revision++
+	todo.touch(&previous, storeTime(m.now()))
+	if err := m.checkParentOpen(&previous, todo); err != nil {
+		return nil, err
+	}
+	if err := m.recordHistory(ctx, HistoryUpdate, &previous, &todo); err != nil {
+		return nil, err
+	}
+
+	m.todos[patch.ID] = todo
+
+	return &todo, nil
+}
+
+// Batch applies ops to a copy of the todos and their dependencies, which
+// replaces them only if every op succeeds.
+func (m *MemoryStore) Batch(ctx context.Context, ops []BatchOp) ([]BatchResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	todos, lastID, blockers, history := m.todos, m.lastID, m.blockers, len(m.history)
+	m.todos = make(map[int]Todo, len(todos))
+	for id, todo := range todos {
+		m.todos[id] = todo
+	}
+	m.blockers = make(map[int]map[int]bool, len(blockers))
+	for id, ids := range blockers {
+		m.blockers[id] = make(map[int]bool, len(ids))
+		for blockerID := range ids {
+			m.blockers[id][blockerID] = true
+		}
+	}
+
+	results := make([]BatchResult, len(ops))
+	for i, op := range ops {
+		var err error
+		switch op.Kind {
+		case BatchPut:
+			results[i].Todo, results[i].Created, err = m.upsert(ctx, op.Todo, op.Revision)
+		case BatchPatch:
+			results[i].Todo, err = m.patch(ctx, op.Patch, op.Revision)
+		case BatchDelete:
+			err = m.delete(ctx, op.ID, op.Revision)
+		default:
+			err = ErrInvalidBatchOp{Kind: op.Kind}
+		}
+		if err != nil {
+			m.todos, m.lastID, m.blockers, m.history = todos, lastID, blockers, m.history[:history]
+			return nil, ErrBatchOp{Index: i, Err: err}
+		}
+	}
+
+	return results, nil
+}
+
+func (m *MemoryStore) Tags(_ context.Context) ([]TagCount, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, todo := range m.todos {
+		if todo.DeletedAt != nil {
+			continue
+		}
+		for _, tag := range todo.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, TagCount{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+
+	return tags, nil
+}
+
+// checkList returns ErrUnknownList if listID is set to a list that does not
+// exist. The caller must hold m.mu.
+func (m *MemoryStore) checkList(listID *int) error {
+	if listID == nil || *listID == 0 {
+		return nil
+	}
+	if _, ok := m.lists[*listID]; !ok {
+		return ErrUnknownList{ID: *listID}
+	}
+	return nil
+}
+
+// checkParent returns the error for nesting the todo with the given id under
+// parentID. The caller must hold m.mu.
+func (m *MemoryStore) checkParent(id int, parentID *int) error {
+	if parentID == nil || *parentID == 0 {
+		return nil
+	}
+
+	parent, ok := m.get(*parentID)
+	if !ok {
+		return ErrUnknownParent{ID: *parentID}
+	}
+
+	for ancestor := &parent; ancestor != nil; {
+		if ancestor.ID == id {
+			return ErrParentCycle{ID: id, ParentID: *parentID}
+		}
+		if ancestor.ParentID == nil {
+			break
+		}
+		next := m.todos[*ancestor.ParentID]
+		ancestor = &next
+	}
+	return nil
+}
+
+// checkParentOpen returns ErrOpenChildren if writing todo, stored as previous
+// before or nil if it is created, makes it an open child of a completed todo.
+// The caller must hold m.mu.
+func (m *MemoryStore) checkParentOpen(previous *Todo, todo Todo) error {
+	if opensChild(previous, todo) && m.todos[*todo.ParentID].Completed {
+		return ErrOpenChildren{ID: *todo.ParentID, ChildID: todo.ID}
+	}
+	return nil
+}
+
+// checkChildrenCompleted returns ErrOpenChildren if the todo with the given id
+// has open children. The caller must hold m.mu.
+func (m *MemoryStore) checkChildrenCompleted(id int) error {
+	for _, child := range m.todos {
+		if child.ParentID != nil && *child.ParentID == id && !child.Completed && child.DeletedAt == nil {
+			return ErrOpenChildren{ID: id}
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Descendants(_ context.Context, id int) ([]Todo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.get(id); !ok {
+		return nil, ErrNotFound{ID: id}
+	}
+
+	descendants := []Todo{}
+	parents := map[int]bool{id: true}
+	for len(parents) > 0 {
+		children := make(map[int]bool)
+		for _, todo := range m.todos {
+			if todo.ParentID != nil && parents[*todo.ParentID] && todo.DeletedAt == nil {
+				descendants = append(descendants, todo)
+				children[todo.ID] = true
+			}
+		}
+		parents = children
+	}
+	sort.Slice(descendants, func(i, j int) bool { return descendants[i].ID < descendants[j].ID })
+
+	return descendants, nil
+}
+
+// get returns the todo with the given id, unless it does not exist or is in
+// the trash. The caller must hold m.mu.
+func (m *MemoryStore) get(id int) (Todo, bool) {
+	todo, ok := m.todos[id]
+	return todo, ok && todo.DeletedAt == nil
+}
+
+// deleteTodo deletes the todo with the given id and its dependencies. The
+// caller must hold m.mu.
+func (m *MemoryStore) deleteTodo(id int) {
+	delete(m.todos, id)
+	delete(m.blockers, id)
+	for _, blockers := range m.blockers {
+		delete(blockers, id)
+	}
+}
+
+// blocked reports whether the todo with the given id is blocked by an open
+// todo. The caller must hold m.mu.
+func (m *MemoryStore) blocked(id int) bool {
+	for blockerID := range m.blockers[id] {
+		if blocker := m.todos[blockerID]; !blocker.Completed && blocker.DeletedAt == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryStore) AddBlocker(_ context.Context, id, blockerID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, todoID := range []int{id, blockerID} {
+		if _, ok := m.get(todoID); !ok {
+			return ErrNotFound{ID: todoID}
+		}
+	}
+
+	// The todo would block itself if it already blocks blockerID, directly
+	// or not.
+	seen := make(map[int]bool)
+	next := []int{blockerID}
+	for len(next) > 0 {
+		todoID := next[len(next)-1]
+		next = next[:len(next)-1]
+		if todoID == id {
+			return ErrDependencyCycle{ID: id, BlockerID: blockerID}
+		}
+		if seen[todoID] {
+			continue
+		}
+		seen[todoID] = true
+		for blocker := range m.blockers[todoID] {
+			next = append(next, blocker)
+		}
+	}
+
+	if m.blockers[id] == nil {
+		m.blockers[id] = make(map[int]bool)
+	}
+	m.blockers[id][blockerID] = true
+	return nil
+}
+
+func (m *MemoryStore) RemoveBlocker(_ context.Context, id, blockerID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.get(id); !ok {
+		return ErrNotFound{ID: id}
+	}
+	if !m.blockers[id][blockerID] {
+		return ErrDependencyNotFound{ID: id, BlockerID: blockerID}
+	}
+
+	delete(m.blockers[id], blockerID)
+	return nil
+}
+
+func (m *MemoryStore) Blockers(_ context.Context, id int) ([]Todo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.get(id); !ok {
+		return nil, ErrNotFound{ID: id}
+	}
+
+	blockers := []Todo{}
+	for blockerID := range m.blockers[id] {
+		if blocker, ok := m.get(blockerID); ok {
+			blockers = append(blockers, blocker)
+		}
+	}
+	sort.Slice(blockers, func(i, j int) bool { return blockers[i].ID < blockers[j].ID })
+
+	return blockers, nil
+}
+
+func (m *MemoryStore) Next(_ context.Context, limit int) ([]Todo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	todos := make([]Todo, 0, len(m.todos))
+	for _, todo := range m.todos {
+		if todo.DeletedAt == nil {
+			todos = append(todos, todo)
+		}
+	}
+
+	var dependencies []Dependency
+	for id, blockers := range m.blockers {
+		for blockerID := range blockers {
+			dependencies = append(dependencies, Dependency{TodoID: id, BlockerID: blockerID})
+		}
+	}
+
+	return topologicalOrder(todos, dependencies, limit), nil
+}
+
+func (m *MemoryStore) CreateList(_ context.Context, list List) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastListID++
+	list.ID = m.lastListID
+	list.CreatedAt = storeTime(m.now())
+	list.UpdatedAt = list.CreatedAt
+	m.lists[list.ID] = list
+	return &list, nil
+}
+
+func (m *MemoryStore) GetList(_ context.Context, id int) (*List, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list, ok := m.lists[id]
+	if !ok {
+		return nil, ErrListNotFound{ID: id}
+	}
+	return &list, nil
+}
+
+func (m *MemoryStore) GetLists(_ context.Context) ([]List, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	lists := make([]List, 0, len(m.lists))
+	for _, list := range m.lists {
+		lists = append(lists, list)
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].ID < lists[j].ID })
+
+	return lists, nil
+}
+
+func (m *MemoryStore) UpdateList(_ context.Context, list List) (*List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous, ok := m.lists[list.ID]
+	if !ok {
+		return nil, ErrListNotFound{ID: list.ID}
+	}
+
+	list.CreatedAt = previous.CreatedAt
+	list.UpdatedAt = storeTime(m.now())
+	m.lists[list.ID] = list
+	return &list, nil
+}
+
+func (m *MemoryStore) DeleteList(ctx context.Context, id int, cascade bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.lists[id]; !ok {
+		return ErrListNotFound{ID: id}
+	}
+
+	inList := func(todo Todo) bool { return todo.ListID != nil && *todo.ListID == id }
+	var todoIDs []int
+	for _, todo := range m.todos {
+		if inList(todo) {
+			todoIDs = append(todoIDs, todo.ID)
+			if todo.DeletedAt == nil && !cascade {
+				return ErrListNotEmpty{ID: id}
+			}
+		}
+	}
+
+	// Without cascade only todos in the trash are left in the list, they are
+	// taken out of it so that they can still be restored.
+	if !cascade {
+		if err := m.detachTrashed(ctx, inList, func(todo *Todo) { todo.ListID = nil }); err != nil {
+			return err
+		}
+		delete(m.lists, id)
+		return nil
+	}
+
+	// The todos of the list go with it, the ones in the trash too. Their
+	// children in other lists must be deleted first, the ones in the trash
+	// are taken out from under them.
+	isChild := func(todo Todo) bool {
+		return todo.ParentID != nil && !inList(todo) && inList(m.todos[*todo.ParentID])
+	}
+	for _, todo := range m.todos {
+		if isChild(todo) && todo.DeletedAt == nil {
+			return ErrHasChildren{ID: *todo.ParentID}
+		}
+	}
+	if err := m.detachTrashed(ctx, isChild, func(todo *Todo) { todo.ParentID = nil }); err != nil {
+		return err
+	}
+
+	if err := m.purge(ctx, todoIDs); err != nil {
+		return err
+	}
+
+	delete(m.lists, id)
+	return nil
+}
@@ -0,0 +1,310 @@
+package todos
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMemoryGetTodoNotFound(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+
+	todo, err := store.Get(context.Background(), 1)
+	if todo != nil {
+		t.Fatalf("expected todo to be nil, got %v", todo)
+	}
+
+	var notFound ErrNotFound
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected error to be ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoryGetTodo(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+	store.now = testTime
+
+	want := exampleTodo()
+	if _, _, err := store.Upsert(context.Background(), want, NoRevision); err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+
+	got, err := store.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+
+	want.Revision = 1
+	want.CreatedAt = testTime()
+	want.UpdatedAt = testTime()
+	if !reflect.DeepEqual(*got, want) {
+		t.Fatalf("expected todo to be %v, got %v", want, got)
+	}
+}
+
+func TestMemoryCreateTodo(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+
+	if _, _, err := store.Upsert(context.Background(), exampleTodo(), NoRevision); err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+
+	created, err := store.Create(context.Background(), exampleTodo())
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	if created.ID != 2 {
+		t.Fatalf("expected id %d, got %d", 2, created.ID)
+	}
+
+	got, err := store.Get(context.Background(), created.ID)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, created) {
+		t.Fatalf("expected todo to be %v, got %v", created, got)
+	}
+}
+
+func TestMemoryInsertAndUpsert(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+
+	_, created, err := store.Upsert(context.Background(), exampleTodo(), AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to upsert todo: %v", err)
+	}
+	if !created {
+		t.Fatalf("expected todo to be created")
+	}
+
+	var alreadyExists ErrAlreadyExists
+	if _, _, err := store.Upsert(context.Background(), exampleTodo(), NoRevision); !errors.As(err, &alreadyExists) {
+		t.Fatalf("expected error to be ErrAlreadyExists, got %v", err)
+	}
+
+	got, created, err := store.Upsert(context.Background(), exampleTodo(), 1)
+	if err != nil {
+		t.Fatalf("failed to upsert todo: %v", err)
+	}
+	if created {
+		t.Fatalf("expected todo to be replaced")
+	}
+	if got.Revision != 2 {
+		t.Fatalf("expected revision %d, got %d", 2, got.Revision)
+	}
+
+	var mismatch ErrRevisionMismatch
+	if _, _, err := store.Upsert(context.Background(), exampleTodo(), 1); !errors.As(err, &mismatch) {
+		t.Fatalf("expected error to be ErrRevisionMismatch, got %v", err)
+	}
+	if err := store.Delete(context.Background(), 1, 1); !errors.As(err, &mismatch) {
+		t.Fatalf("expected error to be ErrRevisionMismatch, got %v", err)
+	}
+}
+
+func TestMemoryDeleteTodo(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+
+	if _, _, err := store.Upsert(context.Background(), exampleTodo(), NoRevision); err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+
+	if err := store.Delete(context.Background(), 1, AnyRevision); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+
+	var notFound ErrNotFound
+	if _, err := store.Get(context.Background(), 1); !errors.As(err, &notFound) {
+		t.Fatalf("expected error to be ErrNotFound, got %v", err)
+	}
+
+	if err := store.Delete(context.Background(), 1, AnyRevision); !errors.As(err, &notFound) {
+		t.Fatalf("expected error to be ErrNotFound, got %v", err)
+	}
+
+	description := ""
+	patch := NewTodoPatch()
+	patch.ID = 1
+	patch.Description = &description
+	if _, err := store.Patch(context.Background(), patch, AnyRevision); !errors.As(err, &notFound) {
+		t.Fatalf("expected error to be ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoryGetTodosOrderedByID(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+
+	for _, id := range []int{3, 1, 2} {
+		todo := exampleTodo()
+		todo.ID = id
+		if _, _, err := store.Upsert(context.Background(), todo, NoRevision); err != nil {
+			t.Fatalf("failed to insert todo: %v", err)
+		}
+	}
+
+	todos, err := store.List(context.Background(), ListOptions{Limit: MaxListLimit})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+
+	for i, todo := range todos {
+		if todo.ID != i+1 {
+			t.Fatalf("expected todo %d to have id %d, got %d", i, i+1, todo.ID)
+		}
+	}
+}
+
+func TestMemoryListTodos(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+
+	for range 3 {
+		if _, err := store.Create(context.Background(), exampleTodo()); err != nil {
+			t.Fatalf("failed to create todo: %v", err)
+		}
+	}
+
+	todos, err := store.List(context.Background(), ListOptions{Limit: 2, After: &Cursor{ID: 1}})
+	if err != nil {
+		t.Fatalf("failed to list todos: %v", err)
+	}
+	if len(todos) != 2 || todos[0].ID != 2 || todos[1].ID != 3 {
+		t.Fatalf("expected todos 2 and 3, got %v", todos)
+	}
+}
+
+func TestMemoryListTodosOptions(t *testing.T) {
+	t.Parallel()
+	testListOptions(t, NewMemoryStore())
+}
+
+func TestMemoryPatchTodo(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+	store.now = testTime
+
+	if _, _, err := store.Upsert(context.Background(), exampleTodo(), NoRevision); err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+
+	if _, err := store.Patch(context.Background(), NewTodoPatch(), AnyRevision); !errors.Is(err, ErrNoFieldsToUpdate) {
+		t.Fatalf("expected error to be ErrNoFieldsToUpdate, got %v", err)
+	}
+
+	completed := true
+	patch := NewTodoPatch()
+	patch.ID = 1
+	patch.Completed = &completed
+	if _, err := store.Patch(context.Background(), patch, AnyRevision); err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+
+	got, err := store.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+
+	want := exampleTodo()
+	want.Completed = true
+	want.Revision = 2
+	want.CreatedAt = testTime()
+	want.UpdatedAt = testTime()
+	want.CompletedAt = ptr(testTime())
+	if !reflect.DeepEqual(*got, want) {
+		t.Fatalf("expected todo to be %v, got %v", want, got)
+	}
+}
+
+func TestMemoryTodoTimestamps(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+	clock := &testClock{}
+	store.now = clock.Now
+	testTimestamps(t, store, clock)
+}
+
+func TestMemoryTodoDueDates(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+	store.now = testTime
+	testDueDates(t, store)
+}
+
+func TestMemoryTodoTags(t *testing.T) {
+	t.Parallel()
+	testTags(t, NewMemoryStore())
+}
+
+func TestMemoryLists(t *testing.T) {
+	t.Parallel()
+	testLists(t, NewMemoryStore())
+}
+
+func TestMemorySubtasks(t *testing.T) {
+	t.Parallel()
+	testSubtasks(t, NewMemoryStore())
+}
+
+func TestMemoryDependencies(t *testing.T) {
+	t.Parallel()
+	testDependencies(t, NewMemoryStore())
+}
+
+func TestMemoryBatch(t *testing.T) {
+	t.Parallel()
+	testBatch(t, NewMemoryStore())
+}
+
+func TestMemoryTrash(t *testing.T) {
+	t.Parallel()
+	testTrash(t, NewMemoryStore())
+}
+
+func TestMemoryHistory(t *testing.T) {
+	t.Parallel()
+	testHistory(t, NewMemoryStore())
+}
+
+func TestMemoryPatchFunc(t *testing.T) {
+	t.Parallel()
+	testPatchFunc(t, NewMemoryStore())
+}
+
+func TestMemoryConcurrentAccess(t *testing.T) {
+	t.Parallel()
+	store := NewMemoryStore()
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			todo := exampleTodo()
+			todo.ID = id
+			if _, _, err := store.Upsert(context.Background(), todo, NoRevision); err != nil {
+				t.Errorf("failed to insert todo: %v", err)
+			}
+			if _, err := store.List(context.Background(), ListOptions{Limit: MaxListLimit}); err != nil {
+				t.Errorf("failed to get todos: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	todos, err := store.List(context.Background(), ListOptions{Limit: MaxListLimit})
+	if err != nil {
+		t.Fatalf("failed to get todos: %v", err)
+	}
+	if len(todos) != 50 {
+		t.Fatalf("expected 50 todos, got %d", len(todos))
+	}
+}
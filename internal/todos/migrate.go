@@ -0,0 +1,120 @@
+package todos
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the schema migrations. Each file is named
+// `<version>_<name>.sql`, versions start at 1 and have no gaps. Applied
+// migrations must never be edited, add a new file instead.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type migration struct {
+	version int
+	name    string
+	query   string
+}
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// binary than the one running.
+type ErrSchemaTooNew struct {
+	Database int
+	Binary   int
+}
+
+func (e ErrSchemaTooNew) Error() string {
+	return fmt.Sprintf("database schema version `%d` is newer than the latest known version `%d`", e.Database, e.Binary)
+}
+
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(files))
+	for _, file := range files {
+		base := strings.TrimSuffix(path.Base(file), ".sql")
+		rawVersion, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: `%s`", file)
+		}
+
+		version, err := strconv.Atoi(rawVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version: `%s`", file)
+		}
+
+		query, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration{version: version, name: name, query: string(query)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	for i, m := range migrations {
+		if m.version != i+1 {
+			return nil, fmt.Errorf("missing migration version `%d`", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// migrate applies every migration newer than the version recorded in the
+// schema_migrations table. Pending migrations run in a single transaction,
+// so a failure leaves the database at its previous version.
+func migrate(ctx context.Context, db *sql.DB, migrations []migration) error {
+	_, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at TEXT NOT NULL)")
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	current, err := schemaVersion(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	latest := len(migrations)
+	if current > latest {
+		return ErrSchemaTooNew{Database: current, Binary: latest}
+	}
+
+	for _, m := range migrations[current:] {
+		if _, err := tx.ExecContext(ctx, m.query); err != nil {
+			return fmt.Errorf("migration `%d_%s`: %w", m.version, m.name, err)
+		}
+
+		_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)", m.version, m.name, time.Now().UTC().Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func schemaVersion(ctx context.Context, tx *sql.Tx) (int, error) {
+	var version int
+	err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
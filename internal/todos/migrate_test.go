@@ -0,0 +1,146 @@
+package todos
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func testSQLDB(t *testing.T, tempFile *os.File) *sql.DB {
+	db, err := sql.Open("sqlite3", tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func testSchemaVersion(t *testing.T, db *sql.DB) int {
+	var version int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		t.Fatalf("failed to read schema version: %v", err)
+	}
+	return version
+}
+
+func TestMigrateAppliesEmbeddedMigrations(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	db := testSQLDB(t, tempFile)
+	for range 2 {
+		if err := migrate(context.Background(), db, migrations); err != nil {
+			t.Fatalf("failed to migrate: %v", err)
+		}
+	}
+
+	if got := testSchemaVersion(t, db); got != len(migrations) {
+		t.Fatalf("expected schema version %d, got %d", len(migrations), got)
+	}
+}
+
+func TestMigrateAdoptsExistingDatabase(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db := testSQLDB(t, tempFile)
+	_, err := db.Exec("CREATE TABLE todos (id INTEGER PRIMARY KEY, title TEXT, description TEXT, completed BOOLEAN)")
+	if err != nil {
+		t.Fatalf("failed to create legacy table: %v", err)
+	}
+	_, err = db.Exec("INSERT INTO todos (id, title, description, completed) VALUES (1, 'Todo 1', 'Description 1', false)")
+	if err != nil {
+		t.Fatalf("failed to insert legacy todo: %v", err)
+	}
+
+	store, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	got, err := store.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+	if got.Title != "Todo 1" {
+		t.Fatalf("expected title %s, got %s", "Todo 1", got.Title)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	if _, err := NewDB(tempFile.Name()); err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	db := testSQLDB(t, tempFile)
+	_, err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (1000, 'future', '')")
+	if err != nil {
+		t.Fatalf("failed to record future migration: %v", err)
+	}
+
+	_, err = NewDB(tempFile.Name())
+	var tooNew ErrSchemaTooNew
+	if !errors.As(err, &tooNew) {
+		t.Fatalf("expected error to be ErrSchemaTooNew, got %v", err)
+	}
+	if tooNew.Database != 1000 {
+		t.Fatalf("expected database version %d, got %d", 1000, tooNew.Database)
+	}
+}
+
+func TestMigrateRollsBackFailedMigrations(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	migrations, err := loadMigrations(fstest.MapFS{
+		"migrations/0001_first.sql":  {Data: []byte("CREATE TABLE first (id INTEGER PRIMARY KEY);")},
+		"migrations/0002_broken.sql": {Data: []byte("CREATE TABLE broken (;")},
+	})
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	db := testSQLDB(t, tempFile)
+	if err := migrate(context.Background(), db, migrations); err == nil {
+		t.Fatalf("expected migration to fail")
+	}
+
+	if got := testSchemaVersion(t, db); got != 0 {
+		t.Fatalf("expected schema version %d, got %d", 0, got)
+	}
+
+	var tables int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'first'").Scan(&tables); err != nil {
+		t.Fatalf("failed to query tables: %v", err)
+	}
+	if tables != 0 {
+		t.Fatalf("expected table first to be rolled back")
+	}
+}
+
+func TestLoadMigrationsRejectsGaps(t *testing.T) {
+	t.Parallel()
+
+	_, err := loadMigrations(fstest.MapFS{
+		"migrations/0001_first.sql": {Data: []byte("SELECT 1;")},
+		"migrations/0003_third.sql": {Data: []byte("SELECT 1;")},
+	})
+	if err == nil {
+		t.Fatalf("expected missing migration version error")
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE todos ADD COLUMN revision INTEGER NOT NULL DEFAULT 1;
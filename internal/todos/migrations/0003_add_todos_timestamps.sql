@@ -0,0 +1,13 @@
+ALTER TABLE todos ADD COLUMN created_at TEXT;
+ALTER TABLE todos ADD COLUMN updated_at TEXT;
+ALTER TABLE todos ADD COLUMN completed_at TEXT;
+
+-- Todos written before timestamps existed count as created, updated and
+-- completed now. The format matches timeFormat.
+UPDATE todos SET
+    created_at = strftime('%Y-%m-%dT%H:%M:%f000Z', 'now'),
+    updated_at = strftime('%Y-%m-%dT%H:%M:%f000Z', 'now'),
+    completed_at = CASE WHEN completed THEN strftime('%Y-%m-%dT%H:%M:%f000Z', 'now') END;
+
+CREATE INDEX todos_created_at ON todos (created_at);
+CREATE INDEX todos_updated_at ON todos (updated_at);
@@ -0,0 +1,3 @@
+ALTER TABLE todos ADD COLUMN due_at TEXT;
+
+CREATE INDEX todos_due_at ON todos (due_at);
@@ -0,0 +1,5 @@
+-- Priorities are stored by rank, from 0 for low to 3 for urgent, so that
+-- listings sort them in order.
+ALTER TABLE todos ADD COLUMN priority INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX todos_priority ON todos (priority, id);
@@ -0,0 +1,12 @@
+CREATE TABLE lists (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL
+);
+
+-- Deleting a list with todos is refused by the foreign key unless its todos
+-- are deleted first, which is what cascading list deletions do.
+ALTER TABLE todos ADD COLUMN list_id INTEGER REFERENCES lists (id);
+
+CREATE INDEX todos_list_id ON todos (list_id);
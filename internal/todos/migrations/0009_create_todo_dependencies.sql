@@ -0,0 +1,8 @@
+-- todo_id is blocked by blocker_id until blocker_id is completed.
+CREATE TABLE todo_dependencies (
+    todo_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    blocker_id INTEGER NOT NULL REFERENCES todos (id) ON DELETE CASCADE,
+    PRIMARY KEY (todo_id, blocker_id)
+);
+
+CREATE INDEX todo_dependencies_blocker_id ON todo_dependencies (blocker_id, todo_id);
@@ -0,0 +1,4 @@
+-- Deleted todos stay in the trash until they are restored or purged.
+ALTER TABLE todos ADD COLUMN deleted_at TEXT;
+
+CREATE INDEX todos_deleted_at ON todos (deleted_at);
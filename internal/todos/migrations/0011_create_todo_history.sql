@@ -0,0 +1,25 @@
+-- todo_history records every change of a todo. It is append only and has no
+-- foreign key, entries outlive the todos they record. changes is a JSON object
+-- of the changed fields with their before and after values.
+CREATE TABLE todo_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    todo_id INTEGER NOT NULL,
+    action TEXT NOT NULL,
+    revision INTEGER NOT NULL,
+    changes TEXT NOT NULL,
+    request_id TEXT NOT NULL,
+    caller TEXT NOT NULL,
+    created_at TEXT NOT NULL
+);
+
+CREATE INDEX todo_history_todo_id ON todo_history (todo_id, id);
+
+CREATE TRIGGER todo_history_no_update BEFORE UPDATE ON todo_history
+BEGIN
+    SELECT RAISE(ABORT, 'todo_history is append only');
+END;
+
+CREATE TRIGGER todo_history_no_delete BEFORE DELETE ON todo_history
+BEGIN
+    SELECT RAISE(ABORT, 'todo_history is append only');
+END;
@@ -0,0 +1,65 @@
+package todos
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Priority ranks todos for triage. The zero value stands for PriorityNormal.
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+	PriorityUrgent Priority = "urgent"
+)
+
+// priorities lists every priority from the lowest to the highest.
+var priorities = []Priority{PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent}
+
+// ParsePriority parses one of the priority names.
+func ParsePriority(raw string) (Priority, error) {
+	p := Priority(raw)
+	if !slices.Contains(priorities, p) {
+		return "", fmt.Errorf("invalid priority: `%s`, try: [low, normal, high, urgent]", raw)
+	}
+	return p, nil
+}
+
+// UnmarshalJSON rejects the strings that are not a priority name and leaves
+// the priority unchanged for null.
+func (p *Priority) UnmarshalJSON(b []byte) error {
+	var raw *string
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return fmt.Errorf("priority is not a string")
+	}
+	if raw == nil {
+		return nil
+	}
+
+	parsed, err := ParsePriority(*raw)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// rank orders priorities from 0 for the lowest, as the SQLite store keeps
+// them.
+func (p Priority) rank() int {
+	if p == "" {
+		p = PriorityNormal
+	}
+	return slices.Index(priorities, p)
+}
+
+// priorityOf returns the priority with the given rank.
+func priorityOf(rank int) (Priority, error) {
+	if rank < 0 || rank >= len(priorities) {
+		return "", fmt.Errorf("invalid priority rank: `%d`", rank)
+	}
+	return priorities[rank], nil
+}
@@ -0,0 +1,244 @@
+package todos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const valueContentTypeProblem = "application/problem+json"
+
+// ErrorCode identifies the kind of an error answered by the API. Codes are
+// stable, clients may switch on them, while the detail of a problem is meant
+// for humans and may change.
+type ErrorCode string
+
+const (
+	CodeInternal           ErrorCode = "internal_error"
+	CodeRouteNotFound      ErrorCode = "route_not_found"
+	CodeUnauthorized       ErrorCode = "unauthorized"
+	CodeNotImplemented     ErrorCode = "not_implemented"
+	CodeInvalidContentType ErrorCode = "invalid_content_type"
+	CodeInvalidHeader      ErrorCode = "invalid_header"
+	CodeInvalidPath        ErrorCode = "invalid_path"
+	CodeInvalidQuery       ErrorCode = "invalid_query"
+	// CodeNotAcceptable is answered when the `Accept` header of a request
+	// accepts none of the media types the route answers in.
+	CodeNotAcceptable ErrorCode = "not_acceptable"
+	// CodeMalformedBody is answered for bodies that do not decode, such as
+	// invalid JSON or a field of the wrong type.
+	CodeMalformedBody ErrorCode = "malformed_body"
+	// CodeInvalidFields is answered for bodies that decode but have invalid
+	// fields, listed in the errors of the problem.
+	CodeInvalidFields ErrorCode = "invalid_fields"
+	// CodeBodyTooLarge is answered for bodies over MaxBodyBytes.
+	CodeBodyTooLarge ErrorCode = "body_too_large"
+
+	CodeNotFound           ErrorCode = "todo_not_found"
+	CodeNoFieldsToUpdate   ErrorCode = "no_fields_to_update"
+	CodeAlreadyExists      ErrorCode = "todo_already_exists"
+	CodeRevisionMismatch   ErrorCode = "revision_mismatch"
+	CodeListNotFound       ErrorCode = "list_not_found"
+	CodeListNotEmpty       ErrorCode = "list_not_empty"
+	CodeUnknownList        ErrorCode = "unknown_list"
+	CodeUnknownParent      ErrorCode = "unknown_parent"
+	CodeParentCycle        ErrorCode = "parent_cycle"
+	CodeOpenChildren       ErrorCode = "open_children"
+	CodeHasChildren        ErrorCode = "has_children"
+	CodeDependencyCycle    ErrorCode = "dependency_cycle"
+	CodeDependencyNotFound ErrorCode = "dependency_not_found"
+	CodeOpenBlockers       ErrorCode = "open_blockers"
+	CodeInvalidBatchOp     ErrorCode = "invalid_batch_op"
+	CodeTrashed            ErrorCode = "todo_trashed"
+	CodeNotTrashed         ErrorCode = "todo_not_trashed"
+	CodePurged             ErrorCode = "todo_purged"
+	CodeJSONPatchFailed    ErrorCode = "json_patch_failed"
+	// CodeJSONPatchTestFailed is answered when a test operation of a JSON
+	// Patch fails, none of its operations are applied then.
+	CodeJSONPatchTestFailed ErrorCode = "json_patch_test_failed"
+	// CodeNotApplied is the code of the operations of a failed batch that
+	// did not fail themselves.
+	CodeNotApplied ErrorCode = "not_applied"
+
+	// The codes of FieldError.
+	CodeRequired     ErrorCode = "required"
+	CodeInvalidType  ErrorCode = "invalid_type"
+	CodeInvalid      ErrorCode = "invalid"
+	CodeNotAllowed   ErrorCode = "not_allowed"
+	CodeMismatch     ErrorCode = "mismatch"
+	CodeTooLong      ErrorCode = "too_long"
+	CodeTooMany      ErrorCode = "too_many"
+	CodeUnknownField ErrorCode = "unknown_field"
+)
+
+// Problem is an RFC 9457 problem details body, extended with the code of the
+// error, the ID of the request and, for invalid bodies, the fields at fault.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      ErrorCode    `json:"code"`
+	RequestID string       `json:"request_id"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a problem with a field of a request body. Pointer locates the
+// field as a JSON Pointer in a URI fragment, like `#/ops/1/op`.
+type FieldError struct {
+	Pointer string    `json:"pointer"`
+	Code    ErrorCode `json:"code"`
+	Detail  string    `json:"detail"`
+}
+
+// ErrInvalidFields is returned when a request body decodes but some of its
+// fields are invalid.
+type ErrInvalidFields struct {
+	Fields []FieldError
+}
+
+func (e ErrInvalidFields) Error() string {
+	details := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		details[i] = fmt.Sprintf("%s: %s", strings.TrimPrefix(field.Pointer, "#/"), field.Detail)
+	}
+	return strings.Join(details, "; ")
+}
+
+// invalidField returns the error of a single invalid field, named by its JSON
+// name or path like `ops/1/op`.
+func invalidField(field string, code ErrorCode, detail string) ErrInvalidFields {
+	return ErrInvalidFields{Fields: []FieldError{{Pointer: "#/" + field, Code: code, Detail: detail}}}
+}
+
+// writeProblem answers a problem with the request ID of r. The type of every
+// problem is `about:blank`, its code tells problems apart.
+func (h *Handler) writeProblem(w http.ResponseWriter, r *http.Request, status int, code ErrorCode, detail string, fields ...FieldError) {
+	problem := Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: fromContext(r, xRequestIDHeaderKey),
+		Errors:    fields,
+	}
+
+	w.Header().Set(headerContentType, valueContentTypeProblem)
+	w.Header().Set(headerXRequestID, problem.RequestID)
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(problem); err != nil {
+		h.logError(r, "failed to write problem", err)
+	}
+}
+
+// writeInternalError logs err and answers a problem that does not disclose it.
+func (h *Handler) writeInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	h.logError(r, http.StatusText(http.StatusInternalServerError), err)
+	h.writeProblem(w, r, http.StatusInternalServerError, CodeInternal, "")
+}
+
+// writeBodyError answers err, returned reading the body of r: the fields at
+// fault for ErrInvalidFields, 413 for a body too large, and a malformed body
+// otherwise.
+func (h *Handler) writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var fieldsErr ErrInvalidFields
+	if errors.As(err, &fieldsErr) {
+		h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidFields, err.Error(), fieldsErr.Fields...)
+		return
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		h.writeProblem(w, r, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, fmt.Sprintf("body is larger than %d bytes", maxBytesErr.Limit))
+		return
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		field := FieldError{
+			Pointer: "#/" + strings.ReplaceAll(typeErr.Field, ".", "/"),
+			Code:    CodeInvalidType,
+			Detail:  fmt.Sprintf("must be of type %s, got %s", typeErr.Type, typeErr.Value),
+		}
+		h.writeProblem(w, r, http.StatusBadRequest, CodeMalformedBody, err.Error(), field)
+		return
+	}
+
+	h.writeProblem(w, r, http.StatusBadRequest, CodeMalformedBody, err.Error())
+}
+
+// writeIfMatchError answers err, returned reading the `If-Match` header of r:
+// a failed precondition for ErrWeakIfMatch and an invalid header otherwise.
+func (h *Handler) writeIfMatchError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.As(err, new(ErrWeakIfMatch)) {
+		h.writeProblem(w, r, http.StatusPreconditionFailed, CodeRevisionMismatch, err.Error())
+		return
+	}
+	h.writeProblem(w, r, http.StatusBadRequest, CodeInvalidHeader, err.Error())
+}
+
+// writeStoreError maps the errors returned by Store to a problem.
+func (h *Handler) writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := storeErrorProblem(err)
+	if status == http.StatusInternalServerError {
+		h.writeInternalError(w, r, err)
+		return
+	}
+
+	h.writeProblem(w, r, status, code, err.Error())
+}
+
+// storeErrorProblem returns the status code and error code answering err, a
+// Store error, or 500 for the errors the caller is not to blame for.
+func storeErrorProblem(err error) (int, ErrorCode) {
+	switch {
+	case errors.Is(err, ErrNoFieldsToUpdate):
+		return http.StatusBadRequest, CodeNoFieldsToUpdate
+	case errors.As(err, new(ErrNotFound)):
+		return http.StatusNotFound, CodeNotFound
+	case errors.As(err, new(ErrAlreadyExists)):
+		return http.StatusPreconditionFailed, CodeAlreadyExists
+	case errors.As(err, new(ErrRevisionMismatch)):
+		return http.StatusPreconditionFailed, CodeRevisionMismatch
+	case errors.As(err, new(ErrListNotFound)):
+		return http.StatusNotFound, CodeListNotFound
+	case errors.As(err, new(ErrListNotEmpty)):
+		return http.StatusConflict, CodeListNotEmpty
+	case errors.As(err, new(ErrUnknownList)):
+		return http.StatusUnprocessableEntity, CodeUnknownList
+	case errors.As(err, new(ErrUnknownParent)):
+		return http.StatusUnprocessableEntity, CodeUnknownParent
+	case errors.As(err, new(ErrParentCycle)):
+		return http.StatusUnprocessableEntity, CodeParentCycle
+	case errors.As(err, new(ErrOpenChildren)):
+		return http.StatusConflict, CodeOpenChildren
+	case errors.As(err, new(ErrHasChildren)):
+		return http.StatusConflict, CodeHasChildren
+	case errors.As(err, new(ErrDependencyCycle)):
+		return http.StatusUnprocessableEntity, CodeDependencyCycle
+	case errors.As(err, new(ErrDependencyNotFound)):
+		return http.StatusNotFound, CodeDependencyNotFound
+	case errors.As(err, new(ErrOpenBlockers)):
+		return http.StatusConflict, CodeOpenBlockers
+	case errors.As(err, new(ErrInvalidBatchOp)):
+		return http.StatusBadRequest, CodeInvalidBatchOp
+	case errors.As(err, new(ErrTrashed)):
+		return http.StatusConflict, CodeTrashed
+	case errors.As(err, new(ErrNotTrashed)):
+		return http.StatusConflict, CodeNotTrashed
+	case errors.As(err, new(ErrPurged)):
+		return http.StatusConflict, CodePurged
+	case errors.As(err, new(ErrJSONPatchTestFailed)):
+		return http.StatusConflict, CodeJSONPatchTestFailed
+	case errors.As(err, new(ErrJSONPatchFailed)):
+		return http.StatusUnprocessableEntity, CodeJSONPatchFailed
+	default:
+		return http.StatusInternalServerError, CodeInternal
+	}
+}
@@ -0,0 +1,166 @@
+package todos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	// DefaultReminderInterval is how often a Reminder checks for due todos
+	// when its config sets no interval.
+	DefaultReminderInterval = time.Minute
+	// DefaultReminderWindow is how far ahead a todo counts as due soon when
+	// the config of a Reminder sets no window.
+	DefaultReminderWindow = time.Hour
+)
+
+// EventTodoDueSoon is the type of the events sent for todos that are due soon.
+const EventTodoDueSoon = "todo.due_soon"
+
+// Event is what a Reminder posts to its webhook.
+type Event struct {
+	Type string `json:"type"`
+	Todo Todo   `json:"todo"`
+}
+
+// ReminderConfig configures a Reminder. If WebhookURL is empty, events are
+// only logged.
+type ReminderConfig struct {
+	Store      Store
+	Slog       *slog.Logger
+	Interval   time.Duration
+	Window     time.Duration
+	WebhookURL string
+	Client     *http.Client
+}
+
+// Reminder notifies once about every open todo that falls due within its
+// window, by logging an event and posting it to the webhook if there is one.
+// A todo whose due date changes is notified about again.
+type Reminder struct {
+	now        func() time.Time
+	store      Store
+	slog       *slog.Logger
+	interval   time.Duration
+	window     time.Duration
+	webhookURL string
+	client     *http.Client
+	// notified holds the due dates already notified about, by todo ID. It is
+	// only used by the goroutine running the Reminder.
+	notified map[int]time.Time
+}
+
+func NewReminder(c *ReminderConfig) *Reminder {
+	r := &Reminder{
+		now:        time.Now,
+		store:      c.Store,
+		slog:       c.Slog,
+		interval:   c.Interval,
+		window:     c.Window,
+		webhookURL: c.WebhookURL,
+		client:     c.Client,
+		notified:   make(map[int]time.Time),
+	}
+	if r.interval <= 0 {
+		r.interval = DefaultReminderInterval
+	}
+	if r.window <= 0 {
+		r.window = DefaultReminderWindow
+	}
+	if r.client == nil {
+		r.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return r
+}
+
+// Run checks for todos due soon every interval until ctx is done.
+func (r *Reminder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.check(ctx); err != nil {
+			r.slog.Error("failed to check for todos due soon", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check notifies about the open todos due from now to the end of the window
+// that were not notified about yet. A todo whose notification fails is
+// retried on the next check.
+func (r *Reminder) check(ctx context.Context) error {
+	now := storeTime(r.now())
+	for id, dueAt := range r.notified {
+		if dueAt.Before(now) {
+			delete(r.notified, id)
+		}
+	}
+
+	opts := ListOptions{
+		Limit:     MaxListLimit,
+		Completed: ptr(false),
+		DueAt:     TimeRange{After: &now, Before: ptr(now.Add(r.window))},
+	}
+	for {
+		todos, err := r.store.List(ctx, opts)
+		if err != nil {
+			return err
+		}
+
+		for _, todo := range todos {
+			if dueAt, ok := r.notified[todo.ID]; ok && dueAt.Equal(*todo.DueAt) {
+				continue
+			}
+			if err := r.notify(ctx, todo); err != nil {
+				r.slog.Error("failed to notify todo due soon", "id", todo.ID, "error", err)
+				continue
+			}
+			r.notified[todo.ID] = *todo.DueAt
+		}
+
+		if len(todos) < opts.Limit {
+			return nil
+		}
+		opts.After = CursorOf(opts.Sort, todos[len(todos)-1])
+	}
+}
+
+func (r *Reminder) notify(ctx context.Context, todo Todo) error {
+	r.slog.Info("todo due soon", "id", todo.ID, "title", todo.Title, "due_at", todo.DueAt)
+	if r.webhookURL == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(Event{Type: EventTodoDueSoon, Todo: todo})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(headerContentType, valueContentTypeJSON)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package todos
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReminderNotifiesOnce(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var events []Event
+	failures := 1
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var event Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("failed to decode event: %v", err)
+		}
+		events = append(events, event)
+	}))
+	defer webhook.Close()
+
+	store := NewMemoryStore()
+	now := testTime()
+	soon, err := store.Create(ctx, Todo{Title: "Soon", DueAt: ptr(now.Add(30 * time.Minute))})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	for _, todo := range []Todo{
+		{Title: "Later", DueAt: ptr(now.Add(2 * time.Hour))},
+		{Title: "Overdue", DueAt: ptr(now.Add(-time.Minute))},
+		{Title: "Done", Completed: true, DueAt: ptr(now.Add(time.Minute))},
+		{Title: "Undated"},
+	} {
+		if _, err := store.Create(ctx, todo); err != nil {
+			t.Fatalf("failed to create todo: %v", err)
+		}
+	}
+
+	reminder := NewReminder(&ReminderConfig{
+		Store:      store,
+		Slog:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Window:     time.Hour,
+		WebhookURL: webhook.URL,
+	})
+	reminder.now = testTime
+
+	// The first check fails to post to the webhook, so the second retries.
+	for range 3 {
+		if err := reminder.check(ctx); err != nil {
+			t.Fatalf("failed to check: %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(events) != 1 || events[0].Type != EventTodoDueSoon || events[0].Todo.ID != soon.ID {
+		t.Fatalf("expected one %s event for todo %d, got %v", EventTodoDueSoon, soon.ID, events)
+	}
+}
+
+func TestReminderNotifiesChangedDueDate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var notified int
+	webhook := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		notified++
+	}))
+	defer webhook.Close()
+
+	store := NewMemoryStore()
+	todo, err := store.Create(ctx, Todo{Title: "Soon", DueAt: ptr(testTime().Add(time.Minute))})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+
+	reminder := NewReminder(&ReminderConfig{
+		Store:      store,
+		Slog:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WebhookURL: webhook.URL,
+	})
+	reminder.now = testTime
+
+	if err := reminder.check(ctx); err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+
+	patch := NewTodoPatch()
+	patch.ID = todo.ID
+	patch.DueAt = ptr(testTime().Add(2 * time.Minute))
+	if _, err := store.Patch(ctx, patch, AnyRevision); err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+
+	if err := reminder.check(ctx); err != nil {
+		t.Fatalf("failed to check: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if notified != 2 {
+		t.Fatalf("expected 2 notifications, got %d", notified)
+	}
+}
@@ -0,0 +1,318 @@
+package todos
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	headerAccept = "Accept"
+	headerVary   = "Vary"
+
+	valueContentTypeCSV      = "text/csv"
+	valueContentTypeYAML     = "application/yaml"
+	valueContentTypeNDJSON   = "application/x-ndjson"
+	valueContentTypeText     = "text/plain"
+	valueContentTypeMarkdown = "text/markdown"
+)
+
+// todoMediaTypes are the media types todos are answered in, JSON first as it
+// is answered when the request accepts anything. Plain text and Markdown both
+// answer a checklist.
+var todoMediaTypes = []string{
+	valueContentTypeJSON,
+	valueContentTypeCSV,
+	valueContentTypeYAML,
+	valueContentTypeNDJSON,
+	valueContentTypeText,
+	valueContentTypeMarkdown,
+}
+
+// todoCSVHeader names the columns of the CSV rendering, the JSON names of the
+// fields of Todo.
+var todoCSVHeader = []string{
+	"id", "title", "description", "completed", "priority", "list_id", "parent_id", "revision",
+	"created_at", "updated_at", "completed_at", "due_at", "tags", "deleted_at",
+}
+
+// negotiate returns the media type of offers to answer r in, or answers 406
+// and returns false if r accepts none of them.
+func (h *Handler) negotiate(w http.ResponseWriter, r *http.Request, offers []string) (string, bool) {
+	w.Header().Add(headerVary, headerAccept)
+	mediaType, ok := preferredMediaType(r, offers)
+	if !ok {
+		detail := fmt.Sprintf("invalid header `%s` value: got `%s`, use one of %s", headerAccept, strings.Join(r.Header.Values(headerAccept), ", "), strings.Join(offers, ", "))
+		h.writeProblem(w, r, http.StatusNotAcceptable, CodeNotAcceptable, detail)
+	}
+	return mediaType, ok
+}
+
+// preferredMediaType returns the media type of offers the `Accept` header of r
+// prefers, the first offer if r has no `Accept` header, and false if r
+// accepts none of them. Offers the header ranks equally are preferred in
+// their order.
+func preferredMediaType(r *http.Request, offers []string) (string, bool) {
+	accept := strings.Join(r.Header.Values(headerAccept), ",")
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		if quality := acceptQuality(ranges, offer); quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best, bestQuality > 0
+}
+
+// mediaRange is a media range of an `Accept` header, like `text/*;q=0.5`.
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept parses the media ranges of an `Accept` header. The ranges with
+// an invalid quality are left out.
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, raw := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(raw, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if mediaType == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(strings.ToLower(key)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				quality = -1
+				break
+			}
+			quality = parsed
+		}
+		if quality >= 0 {
+			ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+		}
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality ranges give mediaType, the one of the most
+// specific range that matches it, or 0 if none does.
+func acceptQuality(ranges []mediaRange, mediaType string) float64 {
+	mainType, _, _ := strings.Cut(mediaType, "/")
+	quality, specificity := 0.0, -1
+	for _, r := range ranges {
+		var s int
+		switch r.mediaType {
+		case mediaType:
+			s = 2
+		case mainType + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			quality, specificity = r.quality, s
+		}
+	}
+	return quality
+}
+
+// writeTodos answers todos in mediaType, one of todoMediaTypes. one tells that
+// the single todo of todos is answered, which JSON and YAML answer as an
+// object rather than a list.
+func (h *Handler) writeTodos(w http.ResponseWriter, r *http.Request, mediaType string, todos []Todo, one bool) {
+	if mediaType == valueContentTypeJSON {
+		if one {
+			h.writeJSON(w, r, http.StatusOK, todos[0])
+		} else {
+			h.writeJSON(w, r, http.StatusOK, todos)
+		}
+		return
+	}
+
+	contentType := mediaType
+	if strings.HasPrefix(mediaType, "text/") {
+		contentType += "; charset=utf-8"
+	}
+	w.Header().Set(headerContentType, contentType)
+	w.Header().Set(headerXRequestID, fromContext(r, xRequestIDHeaderKey))
+	w.WriteHeader(http.StatusOK)
+
+	var err error
+	switch mediaType {
+	case valueContentTypeCSV:
+		err = writeCSV(w, todos)
+	case valueContentTypeYAML:
+		err = writeYAML(w, todos, one)
+	case valueContentTypeNDJSON:
+		err = writeNDJSON(w, todos)
+	case valueContentTypeText, valueContentTypeMarkdown:
+		err = writeChecklist(w, todos)
+	default:
+		err = fmt.Errorf("no renderer for `%s`", mediaType)
+	}
+
+	// The status is already sent, the error can only be logged.
+	if err != nil {
+		h.logError(r, "failed to write response", err)
+	}
+}
+
+// writeCSV writes a header row and a row per todo. Tags are joined with `;`,
+// times are RFC 3339 and unset values are empty. Titles, descriptions and tags
+// starting with `=`, `+`, `-`, `@`, a tab or a carriage return are prefixed
+// with `'`, so that spreadsheets do not run them as formulas.
+func writeCSV(w io.Writer, todos []Todo) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(todoCSVHeader); err != nil {
+		return err
+	}
+
+	for _, todo := range todos {
+		record := []string{
+			strconv.Itoa(todo.ID),
+			escapeCSVFormula(todo.Title),
+			escapeCSVFormula(todo.Description),
+			strconv.FormatBool(todo.Completed),
+			string(todo.Priority),
+			formatOptionalID(todo.ListID),
+			formatOptionalID(todo.ParentID),
+			strconv.Itoa(todo.Revision),
+			todo.CreatedAt.Format(time.RFC3339Nano),
+			todo.UpdatedAt.Format(time.RFC3339Nano),
+			formatOptionalTime(todo.CompletedAt),
+			formatOptionalTime(todo.DueAt),
+			escapeCSVFormula(strings.Join(todo.Tags, ";")),
+			formatOptionalTime(todo.DeletedAt),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// escapeCSVFormula returns cell prefixed with `'` if a spreadsheet would read
+// it as a formula.
+func escapeCSVFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// writeYAML writes todos as a YAML sequence of mappings, or the single todo
+// as a mapping if one is set. Strings are double quoted, so that no title is
+// read back as another type.
+func writeYAML(w io.Writer, todos []Todo, one bool) error {
+	if !one && len(todos) == 0 {
+		_, err := io.WriteString(w, "[]\n")
+		return err
+	}
+
+	var b strings.Builder
+	for _, todo := range todos {
+		tags := make([]string, len(todo.Tags))
+		for i, tag := range todo.Tags {
+			tags[i] = strconv.Quote(tag)
+		}
+
+		fields := []struct{ key, value string }{
+			{"id", strconv.Itoa(todo.ID)},
+			{"title", strconv.Quote(todo.Title)},
+			{"description", strconv.Quote(todo.Description)},
+			{"completed", strconv.FormatBool(todo.Completed)},
+			{"priority", string(todo.Priority)},
+			{"list_id", formatOptionalID(todo.ListID)},
+			{"parent_id", formatOptionalID(todo.ParentID)},
+			{"revision", strconv.Itoa(todo.Revision)},
+			{"created_at", todo.CreatedAt.Format(time.RFC3339Nano)},
+			{"updated_at", todo.UpdatedAt.Format(time.RFC3339Nano)},
+			{"completed_at", formatOptionalTime(todo.CompletedAt)},
+			{"due_at", formatOptionalTime(todo.DueAt)},
+			{"tags", "[" + strings.Join(tags, ", ") + "]"},
+			{"deleted_at", formatOptionalTime(todo.DeletedAt)},
+		}
+		for i, field := range fields {
+			switch {
+			case one:
+			case i == 0:
+				b.WriteString("- ")
+			default:
+				b.WriteString("  ")
+			}
+			// Only unset values are empty, strings are quoted.
+			if field.value == "" {
+				field.value = "null"
+			}
+			fmt.Fprintf(&b, "%s: %s\n", field.key, field.value)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeNDJSON writes a JSON object per todo, one per line.
+func writeNDJSON(w io.Writer, todos []Todo) error {
+	encoder := json.NewEncoder(w)
+	for _, todo := range todos {
+		if err := encoder.Encode(todo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeChecklist writes a Markdown task list item per todo, checked when the
+// todo is completed, like `- [x] title`.
+func writeChecklist(w io.Writer, todos []Todo) error {
+	var b strings.Builder
+	for _, todo := range todos {
+		check := " "
+		if todo.Completed {
+			check = "x"
+		}
+		// A line break would end the item.
+		title := strings.Join(strings.Fields(todo.Title), " ")
+		fmt.Fprintf(&b, "- [%s] %s\n", check, title)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatOptionalID returns id as a string, or the empty string if it is nil.
+func formatOptionalID(id *int) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.Itoa(*id)
+}
+
+// formatOptionalTime returns t in RFC 3339, or the empty string if it is nil.
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,134 @@
+package todos
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreferredMediaType(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", valueContentTypeJSON},
+		{"*/*", valueContentTypeJSON},
+		{"application/json", valueContentTypeJSON},
+		{"text/csv", valueContentTypeCSV},
+		{"TEXT/CSV; charset=utf-8", valueContentTypeCSV},
+		{"application/yaml", valueContentTypeYAML},
+		{"application/x-ndjson", valueContentTypeNDJSON},
+		{"text/plain", valueContentTypeText},
+		{"text/markdown", valueContentTypeMarkdown},
+		{"text/*", valueContentTypeCSV},
+		{"text/html, application/xhtml+xml, application/xml;q=0.9, */*;q=0.8", valueContentTypeJSON},
+		{"application/json;q=0.5, text/csv", valueContentTypeCSV},
+		{"text/markdown;q=0.9, text/plain;q=0.9", valueContentTypeText},
+		{"*/*;q=0.1, application/json;q=0", valueContentTypeCSV},
+		{"text/*;q=0, text/markdown", valueContentTypeMarkdown},
+		{"text/csv;q=2, application/yaml", valueContentTypeYAML},
+		{"text/html", ""},
+		{"application/json;q=0", ""},
+	}
+	for _, tt := range tests {
+		r, err := http.NewRequestWithContext(context.Background(), http.MethodGet, "/todos", nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		if tt.accept != "" {
+			r.Header.Set(headerAccept, tt.accept)
+		}
+
+		got, ok := preferredMediaType(r, todoMediaTypes)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Fatalf("%q: expected %q, got %q, %v", tt.accept, tt.want, got, ok)
+		}
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	todos := []Todo{
+		{ID: 1, Title: `=HYPERLINK("http://example.com")`, Description: "+1 for this", Priority: PriorityNormal, Revision: 1, CreatedAt: created, UpdatedAt: created, Tags: []string{"@home", "api"}},
+		{ID: 2, Title: "-2 days", Description: "\tindented", Priority: PriorityLow, Revision: 1, CreatedAt: created, UpdatedAt: created},
+		{ID: 3, Title: "\rreturn", Description: "a = b - c", Priority: PriorityLow, Revision: 1, CreatedAt: created, UpdatedAt: created, Tags: []string{"ops", "-x"}},
+	}
+
+	var b strings.Builder
+	if err := writeCSV(&b, todos); err != nil {
+		t.Fatalf("failed to write CSV: %v", err)
+	}
+	want := "id,title,description,completed,priority,list_id,parent_id,revision,created_at,updated_at,completed_at,due_at,tags,deleted_at\n" +
+		`1,"'=HYPERLINK(""http://example.com"")",'+1 for this,false,normal,,,1,2024-10-01T09:00:00Z,2024-10-01T09:00:00Z,,,'@home;api,` + "\n" +
+		"2,'-2 days,'\tindented,false,low,,,1,2024-10-01T09:00:00Z,2024-10-01T09:00:00Z,,,,\n" +
+		"3,\"'\rreturn\",a = b - c,false,low,,,1,2024-10-01T09:00:00Z,2024-10-01T09:00:00Z,,,ops;-x,\n"
+	if b.String() != want {
+		t.Fatalf("expected CSV\n%q\ngot\n%q", want, b.String())
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2024, 10, 1, 9, 0, 0, 0, time.UTC)
+	todos := []Todo{
+		{ID: 1, Title: `say "hi": now`, Priority: PriorityHigh, ListID: ptr(2), Revision: 1, CreatedAt: created, UpdatedAt: created, Tags: []string{"api", "yes"}},
+		{ID: 2, Title: "true", Completed: true, Priority: PriorityNormal, Revision: 2, CreatedAt: created, UpdatedAt: created, CompletedAt: &created, Tags: []string{}},
+	}
+
+	var b strings.Builder
+	if err := writeYAML(&b, todos, false); err != nil {
+		t.Fatalf("failed to write YAML: %v", err)
+	}
+	want := `- id: 1
+  title: "say \"hi\": now"
+  description: ""
+  completed: false
+  priority: high
+  list_id: 2
+  parent_id: null
+  revision: 1
+  created_at: 2024-10-01T09:00:00Z
+  updated_at: 2024-10-01T09:00:00Z
+  completed_at: null
+  due_at: null
+  tags: ["api", "yes"]
+  deleted_at: null
+- id: 2
+  title: "true"
+  description: ""
+  completed: true
+  priority: normal
+  list_id: null
+  parent_id: null
+  revision: 2
+  created_at: 2024-10-01T09:00:00Z
+  updated_at: 2024-10-01T09:00:00Z
+  completed_at: 2024-10-01T09:00:00Z
+  due_at: null
+  tags: []
+  deleted_at: null
+`
+	if b.String() != want {
+		t.Fatalf("expected YAML\n%s\ngot\n%s", want, b.String())
+	}
+
+	b.Reset()
+	if err := writeYAML(&b, todos[1:], true); err != nil {
+		t.Fatalf("failed to write YAML: %v", err)
+	}
+	if !strings.HasPrefix(b.String(), "id: 2\ntitle: \"true\"\n") {
+		t.Fatalf("expected a single todo as a mapping, got\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := writeYAML(&b, nil, false); err != nil || b.String() != "[]\n" {
+		t.Fatalf("expected an empty sequence, got %q, %v", b.String(), err)
+	}
+}
@@ -6,157 +6,280 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
-	// Register the SQLite driver with the database/sql package
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
-type TodoPatch struct {
-	data map[string]any
+// todoColumns selects a todo, with its tags as a JSON array.
+const todoColumns = "id, title, description, completed, priority, list_id, parent_id, revision, created_at, updated_at, completed_at, due_at, deleted_at, " +
+	"(SELECT json_group_array(tags.name) FROM todo_tags JOIN tags ON tags.id = todo_tags.tag_id WHERE todo_tags.todo_id = todos.id)"
 
-	ID          int
-	Title       *string
-	Description *string
-	Completed   *bool
+// driverName is the go-sqlite3 driver with the functions the queries need.
+// fold lowers text like strings.ToLower, as lower of SQLite only folds ASCII
+// letters, so that queries ignore case like MemoryStore does.
+const driverName = "sqlite3_todos"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("fold", strings.ToLower, true)
+		},
+	})
 }
 
-func NewTodoPatch() TodoPatch {
-	return TodoPatch{data: make(map[string]any)}
+// timeFormat is how timestamps are stored: UTC with a fixed number of
+// fractional digits, so that they compare correctly as text.
+const timeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+type DB struct {
+	now          func() time.Time
+	db           *sql.DB
+	stmtCreate   *sql.Stmt
+	stmtInsert   *sql.Stmt
+	stmtReplace  *sql.Stmt
+	stmtRevision *sql.Stmt
+	stmtGet      *sql.Stmt
+	stmtTrash    *sql.Stmt
 }
 
-func (tp *TodoPatch) UnmarshalJSON(b []byte) error {
-	err := json.Unmarshal(b, &tp.data)
+func NewDB(dbFile string) (*DB, error) {
+	db, err := sql.Open(driverName, dsn(dbFile))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if ID, ok := tp.data["id"]; ok {
-		if ID == nil {
-			return fmt.Errorf("id is required")
-		}
-		floatID, ok := ID.(float64)
-		if !ok {
-			return fmt.Errorf("id is not a float64")
-		}
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
 
-		tp.ID = int(floatID)
+	if err := migrate(context.Background(), db, migrations); err != nil {
+		return nil, err
 	}
 
-	if title, ok := tp.data["title"]; ok {
-		if title == nil {
-			defaultTitle := ""
-			tp.Title = &defaultTitle
-		} else {
-			tp.Title, ok = title.(*string)
-			if !ok {
-				return fmt.Errorf("title is not a string")
-			}
-		}
+	// Created todos get an ID above every ID the history has seen, so that a
+	// purged todo's ID and history are not handed to a new todo.
+	createStmt, err := db.Prepare("INSERT INTO todos (id, title, description, completed, priority, list_id, parent_id, revision, created_at, updated_at, completed_at, due_at) VALUES (MAX(COALESCE((SELECT MAX(id) FROM todos), 0), COALESCE((SELECT MAX(todo_id) FROM todo_history), 0)) + 1, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?) RETURNING " + todoColumns)
+	if err != nil {
+		return nil, err
 	}
 
-	if description, ok := tp.data["description"]; ok {
-		if description == nil {
-			defaultDescription := ""
-			tp.Description = &defaultDescription
-		} else {
-			tp.Description, ok = description.(*string)
-			if !ok {
-				return fmt.Errorf("description is not a string")
-			}
-		}
+	insertStmt, err := db.Prepare("INSERT INTO todos (id, title, description, completed, priority, list_id, parent_id, revision, created_at, updated_at, completed_at, due_at) VALUES (?, ?, ?, ?, ?, ?, ?, 1, ?, ?, ?, ?) RETURNING " + todoColumns)
+	if err != nil {
+		return nil, err
 	}
 
-	if completed, ok := tp.data["completed"]; ok {
-		if completed == nil {
-			defaultCompleted := false
-			tp.Completed = &defaultCompleted
-		} else {
-			tp.Completed, ok = completed.(*bool)
-			if !ok {
-				return fmt.Errorf("completed is not a boolean")
-			}
-		}
+	replaceStmt, err := db.Prepare("UPDATE todos SET title = ?, description = ?, completed = ?, priority = ?, list_id = ?, parent_id = ?, due_at = ?, revision = revision + 1, updated_at = ?, completed_at = CASE WHEN ? THEN COALESCE(completed_at, ?) END WHERE id = ? RETURNING " + todoColumns)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	revisionStmt, err := db.Prepare("SELECT revision, deleted_at IS NOT NULL FROM todos WHERE id = ?")
+	if err != nil {
+		return nil, err
+	}
 
-type Todo struct {
-	ID          int    `json:"id"`
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Completed   bool   `json:"completed"`
-}
+	getStmt, err := db.Prepare("SELECT " + todoColumns + " FROM todos WHERE id = ? AND deleted_at IS NULL")
+	if err != nil {
+		return nil, err
+	}
+
+	trashStmt, err := db.Prepare("UPDATE todos SET deleted_at = ?, revision = revision + 1, updated_at = ? WHERE id = ? RETURNING " + todoColumns)
+	if err != nil {
+		return nil, err
+	}
 
-type ErrNotFound struct {
-	ID int
+	return &DB{
+		now:          time.Now,
+		db:           db,
+		stmtCreate:   createStmt,
+		stmtInsert:   insertStmt,
+		stmtReplace:  replaceStmt,
+		stmtRevision: revisionStmt,
+		stmtGet:      getStmt,
+		stmtTrash:    trashStmt,
+	}, nil
 }
 
-var ErrNoFieldsToUpdate = errors.New("no fields to update")
+func (t *DB) Create(ctx context.Context, todo Todo) (*Todo, error) {
+	todo.touch(nil, storeTime(t.now()))
+	var created Todo
+	err := t.withTx(ctx, func(tx *sql.Tx) error {
+		if err := checkParent(ctx, tx, 0, todo.ParentID); err != nil {
+			return err
+		}
 
-type DB struct {
-	db         *sql.DB
-	stmtInsert *sql.Stmt
-	stmtGet    *sql.Stmt
-	stmtGetAll *sql.Stmt
-	stmtDelete *sql.Stmt
-}
+		var err error
+		created, err = scanTodo(tx.StmtContext(ctx, t.stmtCreate).QueryRowContext(ctx, todo.Title, todo.Description, todo.Completed, todo.Priority.rank(), nullableID(todo.ListID), nullableID(todo.ParentID), formatTime(&todo.CreatedAt), formatTime(&todo.UpdatedAt), formatTime(todo.CompletedAt), formatTime(todo.DueAt)))
+		if err != nil {
+			return err
+		}
 
-func NewDB(dbFile string) (*DB, error) {
-	db, err := sql.Open("sqlite3", dbFile)
+		if err := checkParentOpen(ctx, tx, nil, created); err != nil {
+			return err
+		}
+
+		created.Tags = todo.Tags
+		if err := setTags(ctx, tx, created.ID, todo.Tags); err != nil {
+			return err
+		}
+
+		return t.recordHistory(ctx, tx, HistoryCreate, nil, &created)
+	})
 	if err != nil {
-		return nil, err
+		return nil, unknownListError(err, todo.ListID)
 	}
+	return &created, nil
+}
 
-	_, err = db.Exec("CREATE TABLE IF NOT EXISTS todos (id INTEGER PRIMARY KEY, title TEXT, description TEXT, completed BOOLEAN)")
+func (t *DB) Upsert(ctx context.Context, todo Todo, revision int) (*Todo, bool, error) {
+	var stored *Todo
+	var created bool
+	err := t.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		stored, created, err = t.upsert(ctx, tx, todo, revision)
+		return err
+	})
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	insertStmt, err := db.Prepare("INSERT OR REPLACE INTO todos (id, title, description, completed) VALUES (?, ?, ?, ?)")
+	return stored, created, nil
+}
+
+// upsert is Upsert within tx.
+func (t *DB) upsert(ctx context.Context, tx *sql.Tx, todo Todo, revision int) (*Todo, bool, error) {
+	current, trashed, err := t.revision(ctx, tx, todo.ID)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	getStmt, err := db.Prepare("SELECT id, title, description, completed FROM todos WHERE id = ?")
-	if err != nil {
-		return nil, err
+	if trashed {
+		return nil, false, ErrTrashed{ID: todo.ID}
+	}
+
+	if err := checkRevision(todo.ID, current, revision); err != nil {
+		return nil, false, err
+	}
+
+	if current == 0 {
+		var purged bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM todo_history WHERE todo_id = ?)", todo.ID).Scan(&purged); err != nil {
+			return nil, false, err
+		}
+		if purged {
+			return nil, false, ErrPurged{ID: todo.ID}
+		}
+	}
+
+	if err := checkParent(ctx, tx, todo.ID, todo.ParentID); err != nil {
+		return nil, false, err
+	}
+
+	if current != 0 && todo.Completed {
+		if err := checkChildrenCompleted(ctx, tx, todo.ID); err != nil {
+			return nil, false, err
+		}
+		if err := checkBlockersCompleted(ctx, tx, todo.ID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	var previous, stored Todo
+	now := storeTime(t.now())
+	created := current == 0
+	if !created {
+		if previous, err = scanTodo(tx.StmtContext(ctx, t.stmtGet).QueryRowContext(ctx, todo.ID)); err != nil {
+			return nil, false, err
+		}
 	}
 
-	getAllStmt, err := db.Prepare("SELECT id, title, description, completed FROM todos")
+	if created {
+		todo.touch(nil, now)
+		stored, err = scanTodo(tx.StmtContext(ctx, t.stmtInsert).QueryRowContext(ctx, todo.ID, todo.Title, todo.Description, todo.Completed, todo.Priority.rank(), nullableID(todo.ListID), nullableID(todo.ParentID), formatTime(&todo.CreatedAt), formatTime(&todo.UpdatedAt), formatTime(todo.CompletedAt), formatTime(todo.DueAt)))
+	} else {
+		todo.Tags = normalizeTags(todo.Tags)
+		stored, err = scanTodo(tx.StmtContext(ctx, t.stmtReplace).QueryRowContext(ctx, todo.Title, todo.Description, todo.Completed, todo.Priority.rank(), nullableID(todo.ListID), nullableID(todo.ParentID), formatTime(todo.DueAt), formatTime(&now), todo.Completed, formatTime(&now), todo.ID))
+	}
 	if err != nil {
-		return nil, err
+		return nil, false, unknownListError(err, todo.ListID)
 	}
 
-	deleteStmt, err := db.Prepare("DELETE FROM todos WHERE id = ?")
+	if created {
+		err = checkParentOpen(ctx, tx, nil, stored)
+	} else {
+		err = checkParentOpen(ctx, tx, &previous, stored)
+	}
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	return &DB{db: db, stmtInsert: insertStmt, stmtGet: getStmt, stmtGetAll: getAllStmt, stmtDelete: deleteStmt}, nil
-}
+	stored.Tags = todo.Tags
+	if err := setTags(ctx, tx, todo.ID, todo.Tags); err != nil {
+		return nil, false, err
+	}
 
-func (e ErrNotFound) Error() string {
-	return fmt.Sprintf("todo `%d` not found", e.ID)
+	if created {
+		err = t.recordHistory(ctx, tx, HistoryCreate, nil, &stored)
+	} else {
+		err = t.recordHistory(ctx, tx, HistoryUpdate, &previous, &stored)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &stored, created, nil
 }
 
-func (t *DB) Insert(ctx context.Context, todo Todo) error {
-	_, err := t.stmtInsert.ExecContext(ctx, todo.ID, todo.Title, todo.Description, todo.Completed)
-	return err
+func (t *DB) Delete(ctx context.Context, id int, revision int) error {
+	return t.withTx(ctx, func(tx *sql.Tx) error {
+		return t.delete(ctx, tx, id, revision)
+	})
 }
 
-func (t *DB) Delete(ctx context.Context, id int) error {
-	_, err := t.stmtDelete.ExecContext(ctx, id)
-	return err
+// delete is Delete within tx.
+func (t *DB) delete(ctx context.Context, tx *sql.Tx, id int, revision int) error {
+	current, trashed, err := t.revision(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	if current == 0 || trashed {
+		return ErrNotFound{ID: id}
+	}
+
+	if err := checkRevision(id, current, revision); err != nil {
+		return err
+	}
+
+	var hasChildren bool
+	if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM todos WHERE parent_id = ? AND deleted_at IS NULL)", id).Scan(&hasChildren); err != nil {
+		return err
+	}
+	if hasChildren {
+		return ErrHasChildren{ID: id}
+	}
+
+	previous, err := scanTodo(tx.StmtContext(ctx, t.stmtGet).QueryRowContext(ctx, id))
+	if err != nil {
+		return err
+	}
+
+	now := formatTime(ptr(storeTime(t.now())))
+	deleted, err := scanTodo(tx.StmtContext(ctx, t.stmtTrash).QueryRowContext(ctx, now, now, id))
+	if err != nil {
+		return err
+	}
+
+	return t.recordHistory(ctx, tx, HistoryDelete, &previous, &deleted)
 }
 
 func (t *DB) Get(ctx context.Context, id int) (*Todo, error) {
-	row := t.stmtGet.QueryRowContext(ctx, id)
-	var todo Todo
-	err := row.Scan(&todo.ID, &todo.Title, &todo.Description, &todo.Completed)
+	todo, err := scanTodo(t.stmtGet.QueryRowContext(ctx, id))
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNotFound{ID: id}
 		}
 		return nil, err
@@ -164,27 +287,217 @@ func (t *DB) Get(ctx context.Context, id int) (*Todo, error) {
 	return &todo, nil
 }
 
-func (t *DB) GetAll(ctx context.Context) ([]Todo, error) {
-	rows, err := t.stmtGetAll.QueryContext(ctx)
+func (t *DB) List(ctx context.Context, opts ListOptions) ([]Todo, error) {
+	query, args := listQuery(opts, storeTime(t.now()))
+	rows, err := t.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var todos []Todo
+	todos := make([]Todo, 0, opts.Limit)
 	for rows.Next() {
-		var todo Todo
-		err := rows.Scan(&todo.ID, &todo.Title, &todo.Description, &todo.Completed)
+		todo, err := scanTodo(rows)
 		if err != nil {
 			return nil, err
 		}
 		todos = append(todos, todo)
 	}
 
-	return todos, nil
+	return todos, rows.Err()
+}
+
+// listQuery translates opts to a parameterized query. Pages are read with a
+// keyset condition on the sort columns, so the database seeks to the cursor
+// instead of skipping rows.
+func listQuery(opts ListOptions, now time.Time) (string, []any) {
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+
+	if opts.Trashed {
+		where[0] = "deleted_at IS NOT NULL"
+	}
+
+	if opts.Completed != nil {
+		where = append(where, "completed = ?")
+		args = append(args, *opts.Completed)
+	}
+
+	if opts.Query != "" {
+		pattern := "%" + escapeLike(strings.ToLower(opts.Query)) + "%"
+		where = append(where, `(fold(title) LIKE ? ESCAPE '\' OR fold(description) LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+
+	if opts.ListID != nil {
+		where = append(where, "list_id = ?")
+		args = append(args, *opts.ListID)
+	}
+
+	if opts.ParentID != nil {
+		where = append(where, "parent_id = ?")
+		args = append(args, *opts.ParentID)
+	}
+
+	if opts.Blocked != nil {
+		blocked := "EXISTS (SELECT 1 FROM todo_dependencies JOIN todos AS blockers ON blockers.id = todo_dependencies.blocker_id WHERE todo_dependencies.todo_id = todos.id AND blockers.completed = 0 AND blockers.deleted_at IS NULL)"
+		if !*opts.Blocked {
+			blocked = "NOT " + blocked
+		}
+		where = append(where, blocked)
+	}
+
+	if opts.Overdue != nil {
+		overdue := "(completed = 0 AND due_at IS NOT NULL AND due_at < ?)"
+		if !*opts.Overdue {
+			overdue = "NOT " + overdue
+		}
+		where = append(where, overdue)
+		args = append(args, formatTime(&now))
+	}
+
+	if tags := normalizeTags(opts.Tags); len(tags) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(tags)), ", ")
+		tagged := "id IN (SELECT todo_tags.todo_id FROM todo_tags JOIN tags ON tags.id = todo_tags.tag_id WHERE tags.name IN (" + placeholders + ")"
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+		if opts.AllTags {
+			tagged += " GROUP BY todo_tags.todo_id HAVING COUNT(*) = ?"
+			args = append(args, len(tags))
+		}
+		where = append(where, tagged+")")
+	}
+
+	timeRanges := []struct {
+		column string
+		TimeRange
+	}{
+		{"created_at", opts.CreatedAt},
+		{"updated_at", opts.UpdatedAt},
+		{"completed_at", opts.CompletedAt},
+		{"due_at", opts.DueAt},
+	}
+	for _, timeRange := range timeRanges {
+		if timeRange.After != nil {
+			where = append(where, timeRange.column+" >= ?")
+			args = append(args, formatTime(timeRange.After))
+		}
+		if timeRange.Before != nil {
+			where = append(where, timeRange.column+" < ?")
+			args = append(args, formatTime(timeRange.Before))
+		}
+	}
+
+	column := sortColumn(opts.Sort.Field)
+	operator, direction := ">", "ASC"
+	if opts.Sort.Desc {
+		operator, direction = "<", "DESC"
+	}
+
+	if opts.After != nil {
+		if column == "id" {
+			where = append(where, "id "+operator+" ?")
+			args = append(args, opts.After.ID)
+		} else {
+			key := opts.After.todo()
+			where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, operator))
+			args = append(args, sortKey(opts.Sort.Field, key), sortKey(opts.Sort.Field, key), opts.After.ID)
+		}
+	}
+
+	var queryBuilder strings.Builder
+	queryBuilder.WriteString("SELECT " + todoColumns + " FROM todos")
+	queryBuilder.WriteString(" WHERE " + strings.Join(where, " AND "))
+	if column == "id" {
+		queryBuilder.WriteString(" ORDER BY id " + direction)
+	} else {
+		queryBuilder.WriteString(" ORDER BY " + column + " " + direction + ", id " + direction)
+	}
+	queryBuilder.WriteString(" LIMIT ?")
+	args = append(args, opts.Limit)
+
+	return queryBuilder.String(), args
+}
+
+func sortColumn(field SortField) string {
+	switch field {
+	case SortByTitle:
+		return "title"
+	case SortByPriority:
+		return "priority"
+	default:
+		return "id"
+	}
+}
+
+func sortKey(field SortField, todo Todo) any {
+	switch field {
+	case SortByTitle:
+		return todo.Title
+	case SortByPriority:
+		return todo.Priority.rank()
+	default:
+		return todo.ID
+	}
+}
+
+// escapeLike escapes the LIKE wildcards in s, for patterns using `ESCAPE '\'`.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func (t *DB) Patch(ctx context.Context, patch TodoPatch, revision int) (*Todo, error) {
+	var patched *Todo
+	err := t.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		patched, err = t.patch(ctx, tx, patch, revision)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return patched, nil
+}
+
+func (t *DB) PatchFunc(ctx context.Context, id int, revision int, fn func(Todo) (TodoPatch, error)) (*Todo, error) {
+	var patched *Todo
+	err := t.withTx(ctx, func(tx *sql.Tx) error {
+		current, err := scanTodo(tx.StmtContext(ctx, t.stmtGet).QueryRowContext(ctx, id))
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound{ID: id}
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := checkRevision(id, current.Revision, revision); err != nil {
+			return err
+		}
+
+		patch, err := fn(current)
+		if err != nil {
+			return err
+		}
+		if patch.empty() {
+			patched = &current
+			return nil
+		}
+		patch.ID = id
+
+		patched, err = t.patch(ctx, tx, patch, revision)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return patched, nil
 }
 
-func (t *DB) Patch(ctx context.Context, patch TodoPatch) error {
+// patch is Patch within tx.
+func (t *DB) patch(ctx context.Context, tx *sql.Tx, patch TodoPatch, revision int) (*Todo, error) {
 	var queryBuilder strings.Builder
 	args := []any{}
 
@@ -205,21 +518,796 @@ func (t *DB) Patch(ctx context.Context, patch TodoPatch) error {
 		args = append(args, patch.Completed)
 	}
 
-	if len(args) == 0 {
-		return ErrNoFieldsToUpdate
+	if patch.Priority != nil {
+		queryBuilder.WriteString("priority = ?, ")
+		args = append(args, patch.Priority.rank())
 	}
 
-	query := queryBuilder.String()
-	query = query[:len(query)-2] // Remove trailing comma and space
-	query += " WHERE id = ?"
-	args = append(args, patch.data["id"])
+	if patch.ListID != nil {
+		queryBuilder.WriteString("list_id = ?, ")
+		args = append(args, nullableID(patch.ListID))
+	}
+
+	if patch.ParentID != nil {
+		queryBuilder.WriteString("parent_id = ?, ")
+		args = append(args, nullableID(patch.ParentID))
+	}
+
+	if patch.DueAt != nil {
+		queryBuilder.WriteString("due_at = ?, ")
+		args = append(args, formatTime(patch.DueAt))
+	}
+
+	if patch.empty() {
+		return nil, ErrNoFieldsToUpdate
+	}
+
+	now := formatTime(ptr(storeTime(t.now())))
+	if patch.Completed != nil {
+		queryBuilder.WriteString("completed_at = CASE WHEN ? THEN COALESCE(completed_at, ?) END, ")
+		args = append(args, patch.Completed, now)
+	}
 
-	stmt, err := t.db.Prepare(query)
+	queryBuilder.WriteString("revision = revision + 1, updated_at = ? WHERE id = ? RETURNING " + todoColumns)
+	args = append(args, now, patch.ID)
+
+	current, trashed, err := t.revision(ctx, tx, patch.ID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if current == 0 || trashed {
+		return nil, ErrNotFound{ID: patch.ID}
+	}
+
+	if err := checkRevision(patch.ID, current, revision); err != nil {
+		return nil, err
+	}
+
+	if err := checkParent(ctx, tx, patch.ID, patch.ParentID); err != nil {
+		return nil, err
+	}
+
+	if patch.Completed != nil && *patch.Completed {
+		if err := checkChildrenCompleted(ctx, tx, patch.ID); err != nil {
+			return nil, err
+		}
+		if err := checkBlockersCompleted(ctx, tx, patch.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	previous, err := scanTodo(tx.StmtContext(ctx, t.stmtGet).QueryRowContext(ctx, patch.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.changesTags() {
+		if err := setTags(ctx, tx, patch.ID, patch.tags(previous.Tags)); err != nil {
+			return nil, err
+		}
+	}
+
+	patched, err := scanTodo(tx.QueryRowContext(ctx, queryBuilder.String(), args...))
+	if err != nil {
+		return nil, unknownListError(err, patch.ListID)
+	}
+
+	if err := checkParentOpen(ctx, tx, &previous, patched); err != nil {
+		return nil, err
+	}
+
+	if err := t.recordHistory(ctx, tx, HistoryUpdate, &previous, &patched); err != nil {
+		return nil, err
+	}
+	return &patched, nil
+}
+
+func (t *DB) Batch(ctx context.Context, ops []BatchOp) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ops))
+	err := t.withTx(ctx, func(tx *sql.Tx) error {
+		for i, op := range ops {
+			var err error
+			switch op.Kind {
+			case BatchPut:
+				results[i].Todo, results[i].Created, err = t.upsert(ctx, tx, op.Todo, op.Revision)
+			case BatchPatch:
+				results[i].Todo, err = t.patch(ctx, tx, op.Patch, op.Revision)
+			case BatchDelete:
+				err = t.delete(ctx, tx, op.ID, op.Revision)
+			default:
+				err = ErrInvalidBatchOp{Kind: op.Kind}
+			}
+			if err != nil {
+				return ErrBatchOp{Index: i, Err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (t *DB) Restore(ctx context.Context, id int, revision int) (*Todo, error) {
+	var restored Todo
+	err := t.withTx(ctx, func(tx *sql.Tx) error {
+		current, trashed, err := t.revision(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if current == 0 {
+			return ErrNotFound{ID: id}
+		}
+
+		if !trashed {
+			return ErrNotTrashed{ID: id}
+		}
+
+		if err := checkRevision(id, current, revision); err != nil {
+			return err
+		}
+
+		var parentID int
+		err = tx.QueryRowContext(ctx, "SELECT parents.id FROM todos JOIN todos AS parents ON parents.id = todos.parent_id WHERE todos.id = ? AND parents.deleted_at IS NOT NULL", id).Scan(&parentID)
+		if err == nil {
+			return ErrTrashed{ID: parentID}
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		previous, err := scanTodo(tx.QueryRowContext(ctx, "SELECT "+todoColumns+" FROM todos WHERE id = ?", id))
+		if err != nil {
+			return err
+		}
+
+		restored, err = scanTodo(tx.QueryRowContext(ctx, "UPDATE todos SET deleted_at = NULL, revision = revision + 1, updated_at = ? WHERE id = ? RETURNING "+todoColumns, formatTime(ptr(storeTime(t.now()))), id))
+		if err != nil {
+			return err
+		}
+
+		return t.recordHistory(ctx, tx, HistoryRestore, &previous, &restored)
+	})
+	if err != nil {
+		return nil, err
 	}
-	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, args...)
+	return &restored, nil
+}
+
+func (t *DB) Purge(ctx context.Context, before time.Time) (int, error) {
+	var purged int
+	err := t.withTx(ctx, func(tx *sql.Tx) error {
+		var err error
+		purged, err = t.purge(ctx, tx, "deleted_at < ?", formatTime(&before))
+		return err
+	})
+	return purged, err
+}
+
+// purge permanently deletes the todos matching the condition where, records
+// it in their history and returns how many it deleted.
+func (t *DB) purge(ctx context.Context, tx *sql.Tx, where string, args ...any) (int, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT "+todoColumns+" FROM todos WHERE "+where, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var purged []Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return 0, err
+		}
+		purged = append(purged, todo)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM todos WHERE "+where, args...); err != nil {
+		return 0, err
+	}
+
+	for _, todo := range purged {
+		if err := t.recordHistory(ctx, tx, HistoryPurge, &todo, nil); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(purged), deleteUnusedTags(ctx, tx)
+}
+
+func (t *DB) History(ctx context.Context, id int) ([]HistoryEntry, error) {
+	rows, err := t.db.QueryContext(ctx, "SELECT id, todo_id, action, revision, changes, request_id, caller, created_at FROM todo_history WHERE todo_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []HistoryEntry{}
+	for rows.Next() {
+		var entry HistoryEntry
+		var changes, createdAt string
+		if err := rows.Scan(&entry.ID, &entry.TodoID, &entry.Action, &entry.Revision, &changes, &entry.RequestID, &entry.Caller, &createdAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &entry.Changes); err != nil {
+			return nil, err
+		}
+		if entry.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 {
+		// Todos written before the history existed have none.
+		var exists bool
+		if err := t.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM todos WHERE id = ?)", id).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrNotFound{ID: id}
+		}
+	}
+
+	return entries, nil
+}
+
+// recordHistory records in the history of a todo that it changed from before
+// to after.
+func (t *DB) recordHistory(ctx context.Context, tx *sql.Tx, action HistoryAction, before, after *Todo) error {
+	entry, err := newHistoryEntry(ctx, action, before, after, t.now)
+	if err != nil {
+		return err
+	}
+
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO todo_history (todo_id, action, revision, changes, request_id, caller, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)", entry.TodoID, entry.Action, entry.Revision, string(changes), entry.RequestID, entry.Caller, formatTime(&entry.CreatedAt))
+	return err
+}
+
+func (t *DB) Descendants(ctx context.Context, id int) ([]Todo, error) {
+	if _, err := t.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return t.queryTodos(ctx, "WITH RECURSIVE descendants (id) AS (SELECT id FROM todos WHERE parent_id = ? UNION SELECT todos.id FROM todos JOIN descendants ON todos.parent_id = descendants.id) "+
+		"SELECT "+todoColumns+" FROM todos WHERE id IN descendants AND deleted_at IS NULL ORDER BY id", id)
+}
+
+// checkParent returns the error for nesting the todo with the given id under
+// parentID, walking up the ancestors of parentID.
+func checkParent(ctx context.Context, tx *sql.Tx, id int, parentID *int) error {
+	if parentID == nil || *parentID == 0 {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, "WITH RECURSIVE ancestors (id, parent_id) AS (SELECT id, parent_id FROM todos WHERE id = ? AND deleted_at IS NULL UNION SELECT todos.id, todos.parent_id FROM todos JOIN ancestors ON todos.id = ancestors.parent_id) SELECT id FROM ancestors", *parentID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		var ancestor int
+		if err := rows.Scan(&ancestor); err != nil {
+			return err
+		}
+		if ancestor == id {
+			return ErrParentCycle{ID: id, ParentID: *parentID}
+		}
+		found = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if !found {
+		return ErrUnknownParent{ID: *parentID}
+	}
+	return nil
+}
+
+// checkChildrenCompleted returns ErrOpenChildren if the todo with the given id
+// is being completed while it has open children. Todos that are completed
+// already are left alone.
+func checkChildrenCompleted(ctx context.Context, tx *sql.Tx, id int) error {
+	var open bool
+	err := tx.QueryRowContext(ctx, "SELECT completed = 0 AND EXISTS (SELECT 1 FROM todos AS children WHERE children.parent_id = todos.id AND children.completed = 0 AND children.deleted_at IS NULL) FROM todos WHERE id = ?", id).Scan(&open)
+	if err != nil {
+		return err
+	}
+	if open {
+		return ErrOpenChildren{ID: id}
+	}
+	return nil
+}
+
+// checkParentOpen returns ErrOpenChildren if writing todo, stored as previous
+// before or nil if it is created, makes it an open child of a completed todo.
+func checkParentOpen(ctx context.Context, tx *sql.Tx, previous *Todo, todo Todo) error {
+	if !opensChild(previous, todo) {
+		return nil
+	}
+
+	var completed bool
+	if err := tx.QueryRowContext(ctx, "SELECT completed FROM todos WHERE id = ?", *todo.ParentID).Scan(&completed); err != nil {
+		return err
+	}
+	if completed {
+		return ErrOpenChildren{ID: *todo.ParentID, ChildID: todo.ID}
+	}
+	return nil
+}
+
+// checkBlockersCompleted returns ErrOpenBlockers if the todo with the given id
+// is being completed while it is blocked by open todos. Todos that are
+// completed already are left alone.
+func checkBlockersCompleted(ctx context.Context, tx *sql.Tx, id int) error {
+	var open bool
+	err := tx.QueryRowContext(ctx, "SELECT completed = 0 AND EXISTS (SELECT 1 FROM todo_dependencies JOIN todos AS blockers ON blockers.id = todo_dependencies.blocker_id WHERE todo_dependencies.todo_id = todos.id AND blockers.completed = 0 AND blockers.deleted_at IS NULL) FROM todos WHERE id = ?", id).Scan(&open)
+	if err != nil {
+		return err
+	}
+	if open {
+		return ErrOpenBlockers{ID: id}
+	}
+	return nil
+}
+
+func (t *DB) AddBlocker(ctx context.Context, id, blockerID int) error {
+	return t.withTx(ctx, func(tx *sql.Tx) error {
+		for _, todoID := range []int{id, blockerID} {
+			current, trashed, err := t.revision(ctx, tx, todoID)
+			if err != nil {
+				return err
+			}
+			if current == 0 || trashed {
+				return ErrNotFound{ID: todoID}
+			}
+		}
+
+		// The todo would block itself if it already blocks blockerID,
+		// directly or not.
+		var cycle bool
+		err := tx.QueryRowContext(ctx, "WITH RECURSIVE blockers (id) AS (SELECT ? UNION SELECT todo_dependencies.blocker_id FROM todo_dependencies JOIN blockers ON todo_dependencies.todo_id = blockers.id) "+
+			"SELECT EXISTS (SELECT 1 FROM blockers WHERE id = ?)", blockerID, id).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return ErrDependencyCycle{ID: id, BlockerID: blockerID}
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO todo_dependencies (todo_id, blocker_id) VALUES (?, ?) ON CONFLICT DO NOTHING", id, blockerID)
+		return err
+	})
+}
+
+func (t *DB) RemoveBlocker(ctx context.Context, id, blockerID int) error {
+	return t.withTx(ctx, func(tx *sql.Tx) error {
+		current, trashed, err := t.revision(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if current == 0 || trashed {
+			return ErrNotFound{ID: id}
+		}
+
+		result, err := tx.ExecContext(ctx, "DELETE FROM todo_dependencies WHERE todo_id = ? AND blocker_id = ?", id, blockerID)
+		if err != nil {
+			return err
+		}
+		removed, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			return ErrDependencyNotFound{ID: id, BlockerID: blockerID}
+		}
+		return nil
+	})
+}
+
+func (t *DB) Blockers(ctx context.Context, id int) ([]Todo, error) {
+	if _, err := t.Get(ctx, id); err != nil {
+		return nil, err
+	}
+
+	return t.queryTodos(ctx, "SELECT "+todoColumns+" FROM todos WHERE id IN (SELECT blocker_id FROM todo_dependencies WHERE todo_id = ?) AND deleted_at IS NULL ORDER BY id", id)
+}
+
+func (t *DB) Next(ctx context.Context, limit int) ([]Todo, error) {
+	todos, err := t.queryTodos(ctx, "SELECT "+todoColumns+" FROM todos WHERE completed = 0 AND deleted_at IS NULL")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := t.db.QueryContext(ctx, "SELECT todo_dependencies.todo_id, todo_dependencies.blocker_id FROM todo_dependencies JOIN todos AS blockers ON blockers.id = todo_dependencies.blocker_id WHERE blockers.completed = 0 AND blockers.deleted_at IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var dependencies []Dependency
+	for rows.Next() {
+		var dependency Dependency
+		if err := rows.Scan(&dependency.TodoID, &dependency.BlockerID); err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, dependency)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return topologicalOrder(todos, dependencies, limit), nil
+}
+
+// queryTodos returns the todos selected with todoColumns by query.
+func (t *DB) queryTodos(ctx context.Context, query string, args ...any) ([]Todo, error) {
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	todos := []Todo{}
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return nil, err
+		}
+		todos = append(todos, todo)
+	}
+
+	return todos, rows.Err()
+}
+
+func (t *DB) Tags(ctx context.Context) ([]TagCount, error) {
+	rows, err := t.db.QueryContext(ctx, "SELECT tags.name, COUNT(*) FROM tags JOIN todo_tags ON todo_tags.tag_id = tags.id JOIN todos ON todos.id = todo_tags.todo_id WHERE todos.deleted_at IS NULL GROUP BY tags.name ORDER BY tags.name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+func (t *DB) CreateList(ctx context.Context, list List) (*List, error) {
+	now := formatTime(ptr(storeTime(t.now())))
+	created, err := scanList(t.db.QueryRowContext(ctx, "INSERT INTO lists (name, created_at, updated_at) VALUES (?, ?, ?) RETURNING "+listColumns, list.Name, now, now))
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+func (t *DB) GetList(ctx context.Context, id int) (*List, error) {
+	list, err := scanList(t.db.QueryRowContext(ctx, "SELECT "+listColumns+" FROM lists WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrListNotFound{ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+func (t *DB) GetLists(ctx context.Context) ([]List, error) {
+	rows, err := t.db.QueryContext(ctx, "SELECT "+listColumns+" FROM lists ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []List{}
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+
+	return lists, rows.Err()
+}
+
+func (t *DB) UpdateList(ctx context.Context, list List) (*List, error) {
+	updated, err := scanList(t.db.QueryRowContext(ctx, "UPDATE lists SET name = ?, updated_at = ? WHERE id = ? RETURNING "+listColumns, list.Name, formatTime(ptr(storeTime(t.now()))), list.ID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrListNotFound{ID: list.ID}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func (t *DB) DeleteList(ctx context.Context, id int, cascade bool) error {
+	return t.withTx(ctx, func(tx *sql.Tx) error {
+		var todos int
+		err := tx.QueryRowContext(ctx, "SELECT (SELECT COUNT(*) FROM todos WHERE list_id = lists.id AND deleted_at IS NULL) FROM lists WHERE id = ?", id).Scan(&todos)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrListNotFound{ID: id}
+		}
+		if err != nil {
+			return err
+		}
+
+		if todos > 0 && !cascade {
+			return ErrListNotEmpty{ID: id}
+		}
+
+		// Without cascade only todos in the trash are left in the list, they
+		// are taken out of it so that they can still be restored.
+		if !cascade {
+			if err := t.detachTrashed(ctx, tx, "list_id", "list_id = ?", id); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, "DELETE FROM lists WHERE id = ?", id)
+			return err
+		}
+
+		// The todos of the list go with it, the ones in the trash too. Their
+		// children in other lists must be deleted first, the ones in the trash
+		// are taken out from under them.
+		children := "parent_id IN (SELECT id FROM todos WHERE list_id = ?) AND list_id IS NOT ?"
+		var parentID int
+		err = tx.QueryRowContext(ctx, "SELECT parent_id FROM todos WHERE "+children+" AND deleted_at IS NULL LIMIT 1", id, id).Scan(&parentID)
+		if err == nil {
+			return ErrHasChildren{ID: parentID}
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if err := t.detachTrashed(ctx, tx, "parent_id", children, id, id); err != nil {
+			return err
+		}
+		if _, err := t.purge(ctx, tx, "list_id = ?", id); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM lists WHERE id = ?", id)
+		return err
+	})
+}
+
+// detachTrashed sets column, list_id or parent_id, to null for the todos in
+// the trash that match where, so that they can still be restored once the
+// list or parent they point to is gone.
+func (t *DB) detachTrashed(ctx context.Context, tx *sql.Tx, column, where string, args ...any) error {
+	rows, err := tx.QueryContext(ctx, "SELECT "+todoColumns+" FROM todos WHERE "+where+" AND deleted_at IS NOT NULL ORDER BY id", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var trashed []Todo
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return err
+		}
+		trashed = append(trashed, todo)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := formatTime(ptr(storeTime(t.now())))
+	for _, previous := range trashed {
+		detached, err := scanTodo(tx.QueryRowContext(ctx, "UPDATE todos SET "+column+" = NULL, revision = revision + 1, updated_at = ? WHERE id = ? RETURNING "+todoColumns, now, previous.ID))
+		if err != nil {
+			return err
+		}
+		if err := t.recordHistory(ctx, tx, HistoryUpdate, &previous, &detached); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTags replaces the tags of the todo with the given id, creating the tags
+// that do not exist yet and deleting the ones no todo uses anymore.
+func setTags(ctx context.Context, tx *sql.Tx, id int, tags []string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM todo_tags WHERE todo_id = ?", id); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO tags (name) VALUES (?) ON CONFLICT (name) DO NOTHING", tag); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO todo_tags (todo_id, tag_id) SELECT ?, id FROM tags WHERE name = ?", id, tag); err != nil {
+			return err
+		}
+	}
+
+	return deleteUnusedTags(ctx, tx)
+}
+
+func deleteUnusedTags(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM todo_tags)")
+	return err
+}
+
+// revision returns the current revision of the todo with the given id, or 0
+// if it does not exist, and whether it is in the trash.
+func (t *DB) revision(ctx context.Context, tx *sql.Tx, id int) (int, bool, error) {
+	var revision int
+	var trashed bool
+	err := tx.StmtContext(ctx, t.stmtRevision).QueryRowContext(ctx, id).Scan(&revision, &trashed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return revision, trashed, err
+}
+
+// withTx runs fn in a transaction that is committed if fn succeeds and rolled
+// back otherwise.
+func (t *DB) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTodo reads a row selected with todoColumns.
+func scanTodo(s scanner) (Todo, error) {
+	var todo Todo
+	var createdAt, updatedAt string
+	var priority int
+	var listID, parentID sql.NullInt64
+	var completedAt, dueAt, deletedAt sql.NullString
+	var tags string
+	err := s.Scan(&todo.ID, &todo.Title, &todo.Description, &todo.Completed, &priority, &listID, &parentID, &todo.Revision, &createdAt, &updatedAt, &completedAt, &dueAt, &deletedAt, &tags)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	if todo.Priority, err = priorityOf(priority); err != nil {
+		return Todo{}, err
+	}
+
+	if listID.Valid {
+		todo.ListID = ptr(int(listID.Int64))
+	}
+
+	if parentID.Valid {
+		todo.ParentID = ptr(int(parentID.Int64))
+	}
+
+	if todo.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return Todo{}, err
+	}
+
+	if todo.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt); err != nil {
+		return Todo{}, err
+	}
+
+	if completedAt.Valid {
+		at, err := time.Parse(time.RFC3339Nano, completedAt.String)
+		if err != nil {
+			return Todo{}, err
+		}
+		todo.CompletedAt = &at
+	}
+
+	if dueAt.Valid {
+		at, err := time.Parse(time.RFC3339Nano, dueAt.String)
+		if err != nil {
+			return Todo{}, err
+		}
+		todo.DueAt = &at
+	}
+
+	if deletedAt.Valid {
+		at, err := time.Parse(time.RFC3339Nano, deletedAt.String)
+		if err != nil {
+			return Todo{}, err
+		}
+		todo.DeletedAt = &at
+	}
+
+	if err := json.Unmarshal([]byte(tags), &todo.Tags); err != nil {
+		return Todo{}, err
+	}
+	slices.Sort(todo.Tags)
+
+	return todo, nil
+}
+
+const listColumns = "id, name, created_at, updated_at"
+
+// scanList reads a row selected with listColumns.
+func scanList(s scanner) (List, error) {
+	var list List
+	var createdAt, updatedAt string
+	if err := s.Scan(&list.ID, &list.Name, &createdAt, &updatedAt); err != nil {
+		return List{}, err
+	}
+
+	var err error
+	if list.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return List{}, err
+	}
+	if list.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt); err != nil {
+		return List{}, err
+	}
+	return list, nil
+}
+
+// formatTime returns t in timeFormat, or nil to store NULL if t is nil or
+// the zero time.
+func formatTime(t *time.Time) any {
+	if t == nil || t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(timeFormat)
+}
+
+// dsn opens dbFile with immediate transactions, so a transaction that reads
+// before writing takes the write lock up front instead of failing with
+// SQLITE_BUSY when another connection writes first, and with foreign keys
+// enforced.
+func dsn(dbFile string) string {
+	separator := "?"
+	if strings.Contains(dbFile, "?") {
+		separator = "&"
+	}
+	return dbFile + separator + "_txlock=immediate&_foreign_keys=on"
+}
+
+// nullableID returns id to store, nil for NULL if it is not set or 0.
+func nullableID(id *int) any {
+	if id == nil || *id == 0 {
+		return nil
+	}
+	return *id
+}
+
+// unknownListError returns ErrUnknownList if err is the foreign key failure
+// of writing a todo in the list listID.
+func unknownListError(err error, listID *int) error {
+	var sqliteErr sqlite3.Error
+	if listID != nil && errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey {
+		return ErrUnknownList{ID: *listID}
+	}
 	return err
 }
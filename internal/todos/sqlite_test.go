@@ -4,19 +4,37 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
+func testTempFile(t *testing.T) *os.File {
+	name := fmt.Sprintf("test-%d.db", time.Now().UnixNano())
+	tempFile, err := os.CreateTemp("", name)
+	if err != nil {
+		t.Fatalf("failed to create temp file: %v", err)
+	}
+	return tempFile
+}
+
+// testTime is the clock of stores whose timestamps are compared in tests.
+func testTime() time.Time {
+	return time.Date(2024, time.January, 2, 3, 4, 5, 6000, time.UTC)
+}
+
 func exampleTodo() Todo {
 	return Todo{
 		ID:          1,
 		Title:       "Todo 1",
 		Description: "Description 1",
 		Completed:   false,
+		Priority:    PriorityNormal,
+		Tags:        []string{},
 	}
 }
 
@@ -51,8 +69,10 @@ func TestGetTodo(t *testing.T) {
 		t.Fatalf("failed to create repository: %v", err)
 	}
 
+	db.now = testTime
+
 	want := exampleTodo()
-	err = db.Insert(context.Background(), want)
+	_, _, err = db.Upsert(context.Background(), want, NoRevision)
 	if err != nil {
 		t.Fatalf("failed to insert todo: %v", err)
 	}
@@ -62,6 +82,9 @@ func TestGetTodo(t *testing.T) {
 		t.Fatalf("failed to get todo: %v", err)
 	}
 
+	want.Revision = 1
+	want.CreatedAt = testTime()
+	want.UpdatedAt = testTime()
 	if !reflect.DeepEqual(*got, want) {
 		t.Fatalf("expected todo to be %v, got %v", want, got)
 	}
@@ -77,9 +100,32 @@ func TestDeleteNonExistentTodo(t *testing.T) {
 		t.Fatalf("failed to create repository: %v", err)
 	}
 
-	err = db.Delete(context.Background(), 1)
+	err = db.Delete(context.Background(), 1, AnyRevision)
+	var notFound ErrNotFound
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected error to be ErrNotFound, got %v", err)
+	}
+}
+
+func TestPatchNonExistentTodo(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
 	if err != nil {
-		t.Fatalf("failed to delete todo: %v", err)
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	title := "Todo 1"
+	patch := NewTodoPatch()
+	patch.ID = 1
+	patch.Title = &title
+
+	_, err = db.Patch(context.Background(), patch, AnyRevision)
+	var notFound ErrNotFound
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected error to be ErrNotFound, got %v", err)
 	}
 }
 
@@ -94,12 +140,12 @@ func TestDeleteTodo(t *testing.T) {
 	}
 
 	want := exampleTodo()
-	err = db.Insert(context.Background(), want)
+	_, _, err = db.Upsert(context.Background(), want, NoRevision)
 	if err != nil {
 		t.Fatalf("failed to insert todo: %v", err)
 	}
 
-	err = db.Delete(context.Background(), 1)
+	err = db.Delete(context.Background(), 1, AnyRevision)
 	if err != nil {
 		t.Fatalf("failed to delete todo: %v", err)
 	}
@@ -125,7 +171,7 @@ func TestGetTodos(t *testing.T) {
 		t.Fatalf("failed to create repository: %v", err)
 	}
 
-	todos, err := db.GetAll(context.Background())
+	todos, err := db.List(context.Background(), ListOptions{Limit: MaxListLimit})
 	if err != nil {
 		t.Fatalf("failed to get todos: %v", err)
 	}
@@ -133,12 +179,12 @@ func TestGetTodos(t *testing.T) {
 		t.Fatalf("expected 0 todos, got %d", len(todos))
 	}
 
-	err = db.Insert(context.Background(), exampleTodo())
+	_, _, err = db.Upsert(context.Background(), exampleTodo(), NoRevision)
 	if err != nil {
 		t.Fatalf("failed to insert todo: %v", err)
 	}
 
-	todos, err = db.GetAll(context.Background())
+	todos, err = db.List(context.Background(), ListOptions{Limit: MaxListLimit})
 	if err != nil {
 		t.Fatalf("failed to get todos: %v", err)
 	}
@@ -164,7 +210,7 @@ func TestPatchTodo(t *testing.T) {
 		Completed:   true,
 	}
 
-	err = db.Insert(context.Background(), todo)
+	_, _, err = db.Upsert(context.Background(), todo, NoRevision)
 	if err != nil {
 		t.Fatalf("failed to insert todo: %v", err)
 	}
@@ -176,7 +222,7 @@ func TestPatchTodo(t *testing.T) {
 	}
 	slog.Info("patch", "patch", patch)
 
-	err = db.Patch(context.Background(), patch)
+	_, err = db.Patch(context.Background(), patch, AnyRevision)
 	if err != nil {
 		t.Fatalf("failed to patch todo: %v", err)
 	}
@@ -200,3 +246,374 @@ func TestPatchTodo(t *testing.T) {
 		t.Fatalf("expected title to be Todo 1, got %s", got.Title)
 	}
 }
+
+func TestCreateTodo(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	_, _, err = db.Upsert(context.Background(), exampleTodo(), NoRevision)
+	if err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+
+	todo := exampleTodo()
+	todo.ID = 0
+	created, err := db.Create(context.Background(), todo)
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	if created.ID != 2 {
+		t.Fatalf("expected id %d, got %d", 2, created.ID)
+	}
+
+	got, err := db.Get(context.Background(), created.ID)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, created) {
+		t.Fatalf("expected todo to be %v, got %v", created, got)
+	}
+}
+
+func TestInsertExistingTodo(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	_, _, err = db.Upsert(context.Background(), exampleTodo(), NoRevision)
+	if err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+
+	_, _, err = db.Upsert(context.Background(), exampleTodo(), NoRevision)
+	var alreadyExists ErrAlreadyExists
+	if !errors.As(err, &alreadyExists) {
+		t.Fatalf("expected error to be ErrAlreadyExists, got %v", err)
+	}
+}
+
+func TestUpsertTodo(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	db.now = testTime
+
+	_, created, err := db.Upsert(context.Background(), exampleTodo(), AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to upsert todo: %v", err)
+	}
+	if !created {
+		t.Fatalf("expected todo to be created")
+	}
+
+	want := exampleTodo()
+	want.Title = "Todo 1 updated"
+	got, created, err := db.Upsert(context.Background(), want, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to upsert todo: %v", err)
+	}
+	if created {
+		t.Fatalf("expected todo to be replaced")
+	}
+
+	want.Revision = 2
+	want.CreatedAt = testTime()
+	want.UpdatedAt = testTime()
+	if !reflect.DeepEqual(*got, want) {
+		t.Fatalf("expected todo to be %v, got %v", want, got)
+	}
+
+	got, err = db.Get(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+
+	if !reflect.DeepEqual(*got, want) {
+		t.Fatalf("expected todo to be %v, got %v", want, got)
+	}
+}
+
+func TestWriteRevisions(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	_, _, err = db.Upsert(context.Background(), exampleTodo(), 1)
+	var notFound ErrNotFound
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected error to be ErrNotFound, got %v", err)
+	}
+
+	_, _, err = db.Upsert(context.Background(), exampleTodo(), NoRevision)
+	if err != nil {
+		t.Fatalf("failed to upsert todo: %v", err)
+	}
+
+	_, _, err = db.Upsert(context.Background(), exampleTodo(), NoRevision)
+	var alreadyExists ErrAlreadyExists
+	if !errors.As(err, &alreadyExists) {
+		t.Fatalf("expected error to be ErrAlreadyExists, got %v", err)
+	}
+
+	completed := true
+	patch := NewTodoPatch()
+	patch.ID = 1
+	patch.Completed = &completed
+	patched, err := db.Patch(context.Background(), patch, 1)
+	if err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+	if patched.Revision != 2 {
+		t.Fatalf("expected revision %d, got %d", 2, patched.Revision)
+	}
+
+	_, err = db.Patch(context.Background(), patch, 1)
+	var mismatch ErrRevisionMismatch
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected error to be ErrRevisionMismatch, got %v", err)
+	}
+	if mismatch.Revision != 2 {
+		t.Fatalf("expected current revision %d, got %d", 2, mismatch.Revision)
+	}
+
+	if err := db.Delete(context.Background(), 1, 1); !errors.As(err, &mismatch) {
+		t.Fatalf("expected error to be ErrRevisionMismatch, got %v", err)
+	}
+
+	if err := db.Delete(context.Background(), 1, 2); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+}
+
+func TestListTodos(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	for range 3 {
+		if _, err := db.Create(context.Background(), exampleTodo()); err != nil {
+			t.Fatalf("failed to create todo: %v", err)
+		}
+	}
+
+	todos, err := db.List(context.Background(), ListOptions{Limit: 2})
+	if err != nil {
+		t.Fatalf("failed to list todos: %v", err)
+	}
+	if len(todos) != 2 || todos[0].ID != 1 || todos[1].ID != 2 {
+		t.Fatalf("expected todos 1 and 2, got %v", todos)
+	}
+
+	todos, err = db.List(context.Background(), ListOptions{Limit: 2, After: CursorOf(Sort{}, todos[1])})
+	if err != nil {
+		t.Fatalf("failed to list todos: %v", err)
+	}
+	if len(todos) != 1 || todos[0].ID != 3 {
+		t.Fatalf("expected todo 3, got %v", todos)
+	}
+}
+
+func TestListTodosOptions(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	testListOptions(t, db)
+}
+
+func TestTodoTimestamps(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	clock := &testClock{}
+	db.now = clock.Now
+	testTimestamps(t, db, clock)
+}
+
+func TestTodoDueDates(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	db.now = testTime
+	testDueDates(t, db)
+}
+
+func TestPatchTodoPriority(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	todo := exampleTodo()
+	if _, _, err := db.Upsert(context.Background(), todo, NoRevision); err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+
+	patch := NewTodoPatch()
+	patch.ID = todo.ID
+	patch.Priority = ptr(PriorityUrgent)
+	patched, err := db.Patch(context.Background(), patch, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+	if patched.Priority != PriorityUrgent {
+		t.Fatalf("expected priority %s, got %s", PriorityUrgent, patched.Priority)
+	}
+}
+
+func TestTodoTags(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	testTags(t, db)
+}
+
+func TestLists(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	testLists(t, db)
+}
+
+func TestSubtasks(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	testSubtasks(t, db)
+}
+
+func TestDependencies(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	testDependencies(t, db)
+}
+
+func TestBatch(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	testBatch(t, db)
+}
+
+func TestTrash(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	testTrash(t, db)
+}
+
+func TestPatchFunc(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	testPatchFunc(t, db)
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+	tempFile := testTempFile(t)
+	defer os.Remove(tempFile.Name())
+
+	db, err := NewDB(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+
+	testHistory(t, db)
+
+	if _, err := db.db.ExecContext(context.Background(), "UPDATE todo_history SET caller = 'mallory'"); err == nil {
+		t.Fatalf("expected the history to be append only")
+	}
+}
@@ -0,0 +1,136 @@
+package todos
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// AnyRevision makes a write apply whatever the current revision is.
+	AnyRevision = 0
+	// NoRevision makes a write fail with ErrAlreadyExists if the todo exists.
+	NoRevision = -1
+)
+
+// Store persists todos. DB is the SQLite backed implementation.
+//
+// Writes take the revision the caller expects the todo to be at. Every
+// successful write bumps the revision, starting at 1 on creation, so a caller
+// holding an older revision gets ErrRevisionMismatch instead of overwriting a
+// change it has not seen. Patch and Delete fail with ErrNotFound when the
+// todo does not exist, whatever the revision.
+//
+// Todos nest under their ParentID. Writes fail with ErrUnknownParent if the
+// parent does not exist and with ErrParentCycle if the todo would become its
+// own ancestor. Completing a todo fails with ErrOpenChildren while it has open
+// children, and deleting one fails with ErrHasChildren while it has any.
+//
+// Todos can be blocked by other todos. Completing a todo fails with
+// ErrOpenBlockers while any of its blockers is open.
+//
+// Delete moves a todo to the trash, where it is left out of every read and
+// write but Restore and Purge, as if it did not exist. Its ID stays taken
+// until it is purged: Upsert fails with ErrTrashed meanwhile, and with
+// ErrPurged after, as the ID of a purged todo is never reused.
+//
+// Every change of a todo is recorded in its history, in the same transaction
+// as the change, with the request ID and caller found in the context.
+type Store interface {
+	// Create stores todo under a new ID chosen by the store and returns it.
+	Create(ctx context.Context, todo Todo) (*Todo, error)
+	// Upsert creates or replaces the todo with the ID of todo, returns the
+	// stored todo and reports whether it was created.
+	Upsert(ctx context.Context, todo Todo, revision int) (*Todo, bool, error)
+	Get(ctx context.Context, id int) (*Todo, error)
+	// List returns the page of todos selected by opts.
+	List(ctx context.Context, opts ListOptions) ([]Todo, error)
+	Patch(ctx context.Context, patch TodoPatch, revision int) (*Todo, error)
+	// PatchFunc applies the patch fn returns for the todo with the given id,
+	// reading the todo and writing the patch atomically. An error of fn is
+	// returned as is and nothing is written, as for an empty patch, which
+	// returns the todo unchanged.
+	PatchFunc(ctx context.Context, id int, revision int, fn func(Todo) (TodoPatch, error)) (*Todo, error)
+	Delete(ctx context.Context, id int, revision int) error
+	// Restore takes the todo with the given id out of the trash. It fails with
+	// ErrNotTrashed if the todo is not in the trash and with ErrTrashed if its
+	// parent is.
+	Restore(ctx context.Context, id int, revision int) (*Todo, error)
+	// Purge permanently deletes the todos moved to the trash before before
+	// and returns how many it deleted.
+	Purge(ctx context.Context, before time.Time) (int, error)
+	// Batch applies ops in order, all or none. If an op fails, none of them
+	// are applied and it returns ErrBatchOp with the index of the op.
+	Batch(ctx context.Context, ops []BatchOp) ([]BatchResult, error)
+	// Descendants returns the children of the todo with the given id, their
+	// children and so on, ordered by ID.
+	Descendants(ctx context.Context, id int) ([]Todo, error)
+	// AddBlocker makes the todo with the given id blocked by the todo
+	// blockerID. It fails with ErrNotFound if either does not exist and with
+	// ErrDependencyCycle if the todo would end up blocking itself.
+	AddBlocker(ctx context.Context, id, blockerID int) error
+	// RemoveBlocker fails with ErrDependencyNotFound if the todo with the
+	// given id is not blocked by blockerID.
+	RemoveBlocker(ctx context.Context, id, blockerID int) error
+	// Blockers returns the todos blocking the todo with the given id, ordered
+	// by ID.
+	Blockers(ctx context.Context, id int) ([]Todo, error)
+	// Next returns up to limit open todos in an order they can be done in,
+	// every todo after its open blockers, starting with the actionable ones.
+	Next(ctx context.Context, limit int) ([]Todo, error)
+	// History returns the changes of the todo with the given id, oldest first,
+	// also once it is in the trash or purged. It fails with ErrNotFound if the
+	// todo never existed.
+	History(ctx context.Context, id int) ([]HistoryEntry, error)
+	// Tags returns every tag in use with the number of todos tagged with it,
+	// ordered by name.
+	Tags(ctx context.Context) ([]TagCount, error)
+
+	// Writing a todo with a ListID of a list that does not exist fails with
+	// ErrUnknownList.
+
+	CreateList(ctx context.Context, list List) (*List, error)
+	GetList(ctx context.Context, id int) (*List, error)
+	GetLists(ctx context.Context) ([]List, error)
+	// UpdateList renames the list with the ID of list.
+	UpdateList(ctx context.Context, list List) (*List, error)
+	// DeleteList deletes a list. If the list still has todos, it fails with
+	// ErrListNotEmpty unless cascade is set, which deletes the todos too. A
+	// todo in the list with children in other lists fails the deletion with
+	// ErrHasChildren.
+	DeleteList(ctx context.Context, id int, cascade bool) error
+}
+
+// TagCount is a tag and the number of todos tagged with it.
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+var _ Store = (*DB)(nil)
+
+// checkRevision returns the error for a write expecting revision on a todo
+// that is at current, where 0 means that the todo does not exist.
+func checkRevision(id, current, revision int) error {
+	switch {
+	case revision == NoRevision:
+		if current != 0 {
+			return ErrAlreadyExists{ID: id}
+		}
+	case revision == AnyRevision:
+	case current == 0:
+		return ErrNotFound{ID: id}
+	case current != revision:
+		return ErrRevisionMismatch{ID: id, Revision: current}
+	}
+	return nil
+}
+
+// storeTime returns t as stores keep timestamps, in UTC with microsecond
+// precision.
+func storeTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,1090 @@
+package todos
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a clock that moves one second forward every time it is read.
+type testClock struct {
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.last.IsZero() {
+		c.last = testTime()
+	}
+	c.last = c.last.Add(time.Second)
+	return c.last
+}
+
+// Last returns the time the clock was last read at.
+func (c *testClock) Last() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.last
+}
+
+// testTimestamps checks that a store manages the timestamps of todos and
+// filters listings by them. Both store implementations must pass it.
+func testTimestamps(t *testing.T, store Store, clock *testClock) {
+	ctx := context.Background()
+
+	todo := exampleTodo()
+	todo.CreatedAt = time.Unix(0, 0)
+	created, err := store.Create(ctx, todo)
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	createdAt := clock.Last()
+	if !created.CreatedAt.Equal(createdAt) || !created.UpdatedAt.Equal(createdAt) || created.CompletedAt != nil {
+		t.Fatalf("expected todo created at %v, got %v", createdAt, created)
+	}
+
+	completed := true
+	patch := NewTodoPatch()
+	patch.ID = created.ID
+	patch.Completed = &completed
+	patched, err := store.Patch(ctx, patch, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+	completedAt := clock.Last()
+	if !patched.CreatedAt.Equal(createdAt) || !patched.UpdatedAt.Equal(completedAt) || patched.CompletedAt == nil || !patched.CompletedAt.Equal(completedAt) {
+		t.Fatalf("expected todo completed at %v, got %v", completedAt, patched)
+	}
+
+	todo = *patched
+	todo.Title = "Todo 1 renamed"
+	replaced, _, err := store.Upsert(ctx, todo, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to upsert todo: %v", err)
+	}
+	if replaced.UpdatedAt.Equal(completedAt) || replaced.CompletedAt == nil || !replaced.CompletedAt.Equal(completedAt) {
+		t.Fatalf("expected todo to stay completed at %v, got %v", completedAt, replaced)
+	}
+
+	todo.Completed = false
+	reopened, _, err := store.Upsert(ctx, todo, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to upsert todo: %v", err)
+	}
+	if reopened.CompletedAt != nil || !reopened.CreatedAt.Equal(createdAt) {
+		t.Fatalf("expected todo created at %v to be reopened, got %v", createdAt, reopened)
+	}
+
+	got, err := store.Get(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+	if !reflect.DeepEqual(got, reopened) {
+		t.Fatalf("expected todo to be %v, got %v", reopened, got)
+	}
+
+	other, err := store.Create(ctx, Todo{Title: "Todo 2", Completed: true})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []int
+	}{
+		{"created at or after", ListOptions{CreatedAt: TimeRange{After: &other.CreatedAt}}, []int{other.ID}},
+		{"created before", ListOptions{CreatedAt: TimeRange{Before: &other.CreatedAt}}, []int{created.ID}},
+		{"updated before", ListOptions{UpdatedAt: TimeRange{Before: &reopened.UpdatedAt}}, nil},
+		{"updated at or after", ListOptions{UpdatedAt: TimeRange{After: &reopened.UpdatedAt}}, []int{created.ID, other.ID}},
+		{"completed at or after", ListOptions{CompletedAt: TimeRange{After: &createdAt}}, []int{other.ID}},
+	}
+	for _, tt := range tests {
+		tt.opts.Limit = MaxListLimit
+		todos, err := store.List(ctx, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: failed to list todos: %v", tt.name, err)
+		}
+
+		var ids []int
+		for _, todo := range todos {
+			ids = append(ids, todo.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Fatalf("%s: expected ids %v, got %v", tt.name, tt.want, ids)
+		}
+	}
+}
+
+// testDueDates checks that a store keeps the due dates of todos and filters
+// listings by them at its current time, testTime. Both store implementations
+// must pass it.
+func testDueDates(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := testTime()
+
+	overdue, err := store.Create(ctx, Todo{Title: "Overdue", DueAt: ptr(now.Add(-time.Hour).In(time.FixedZone("CET", 3600)))})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	if overdue.DueAt == nil || !overdue.DueAt.Equal(now.Add(-time.Hour)) || overdue.DueAt.Location() != time.UTC {
+		t.Fatalf("expected todo due at %v in UTC, got %v", now.Add(-time.Hour), overdue.DueAt)
+	}
+
+	upcoming, err := store.Create(ctx, Todo{Title: "Upcoming", DueAt: ptr(now.Add(time.Hour))})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	done, err := store.Create(ctx, Todo{Title: "Done", Completed: true, DueAt: ptr(now.Add(-time.Hour))})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	undated, err := store.Create(ctx, Todo{Title: "Undated"})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []int
+	}{
+		{"overdue", ListOptions{Overdue: ptr(true)}, []int{overdue.ID}},
+		{"not overdue", ListOptions{Overdue: ptr(false)}, []int{upcoming.ID, done.ID, undated.ID}},
+		{"due before", ListOptions{DueAt: TimeRange{Before: &now}}, []int{overdue.ID, done.ID}},
+		{"due at or after", ListOptions{DueAt: TimeRange{After: &now}}, []int{upcoming.ID}},
+	}
+	for _, tt := range tests {
+		tt.opts.Limit = MaxListLimit
+		todos, err := store.List(ctx, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: failed to list todos: %v", tt.name, err)
+		}
+
+		var ids []int
+		for _, todo := range todos {
+			ids = append(ids, todo.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Fatalf("%s: expected ids %v, got %v", tt.name, tt.want, ids)
+		}
+	}
+
+	patch := NewTodoPatch()
+	patch.ID = overdue.ID
+	patch.DueAt = &time.Time{}
+	patched, err := store.Patch(ctx, patch, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+	if patched.DueAt != nil {
+		t.Fatalf("expected due date to be removed, got %v", patched.DueAt)
+	}
+
+	patch.DueAt = ptr(now.Add(24 * time.Hour))
+	patched, err = store.Patch(ctx, patch, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+
+	got, err := store.Get(ctx, overdue.ID)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+	if !reflect.DeepEqual(got, patched) || got.DueAt == nil || !got.DueAt.Equal(now.Add(24*time.Hour)) {
+		t.Fatalf("expected todo to be %v due in a day, got %v", patched, got)
+	}
+}
+
+// testTags checks that a store keeps the tags of todos, patches them and
+// counts them. Both store implementations must pass it.
+func testTags(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	backend, err := store.Create(ctx, Todo{Title: "Backend", Tags: []string{"urgent", " backend", "backend", ""}})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	if want := []string{"backend", "urgent"}; !reflect.DeepEqual(backend.Tags, want) {
+		t.Fatalf("expected tags %v, got %v", want, backend.Tags)
+	}
+
+	if _, _, err := store.Upsert(ctx, Todo{ID: 10, Title: "Frontend", Tags: []string{"frontend", "urgent"}}, NoRevision); err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+	untagged, _, err := store.Upsert(ctx, Todo{ID: 11, Title: "Untagged"}, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to upsert todo: %v", err)
+	}
+	if untagged.Tags == nil || len(untagged.Tags) != 0 {
+		t.Fatalf("expected empty tags, got %#v", untagged.Tags)
+	}
+
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []int
+	}{
+		{"any tag", ListOptions{Tags: []string{"backend", "frontend"}}, []int{backend.ID, 10}},
+		{"all tags", ListOptions{Tags: []string{"urgent", "frontend"}, AllTags: true}, []int{10}},
+		{"all tags repeated", ListOptions{Tags: []string{"urgent", "urgent"}, AllTags: true}, []int{backend.ID, 10}},
+		{"unknown tag", ListOptions{Tags: []string{"ops"}}, nil},
+	}
+	for _, tt := range tests {
+		tt.opts.Limit = MaxListLimit
+		todos, err := store.List(ctx, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: failed to list todos: %v", tt.name, err)
+		}
+
+		var ids []int
+		for _, todo := range todos {
+			ids = append(ids, todo.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Fatalf("%s: expected ids %v, got %v", tt.name, tt.want, ids)
+		}
+	}
+
+	patch := NewTodoPatch()
+	patch.ID = backend.ID
+	patch.AddTags = []string{"api"}
+	patch.RemoveTags = []string{"urgent"}
+	patched, err := store.Patch(ctx, patch, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+	if want := []string{"api", "backend"}; !reflect.DeepEqual(patched.Tags, want) {
+		t.Fatalf("expected tags %v, got %v", want, patched.Tags)
+	}
+
+	got, err := store.Get(ctx, backend.ID)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+	if !reflect.DeepEqual(got, patched) {
+		t.Fatalf("expected todo to be %v, got %v", patched, got)
+	}
+
+	if err := store.Delete(ctx, 10, AnyRevision); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+
+	tags, err := store.Tags(ctx)
+	if err != nil {
+		t.Fatalf("failed to get tags: %v", err)
+	}
+	want := []TagCount{{Name: "api", Count: 1}, {Name: "backend", Count: 1}}
+	if !reflect.DeepEqual(tags, want) {
+		t.Fatalf("expected tags %v, got %v", want, tags)
+	}
+
+	patch.Tags = &[]string{}
+	patch.AddTags = nil
+	patch.RemoveTags = nil
+	if _, err := store.Patch(ctx, patch, AnyRevision); err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+
+	tags, err = store.Tags(ctx)
+	if err != nil {
+		t.Fatalf("failed to get tags: %v", err)
+	}
+	if len(tags) != 0 {
+		t.Fatalf("expected no tags, got %v", tags)
+	}
+}
+
+// testLists checks that a store keeps lists, the todos in them and refuses to
+// delete lists that still have todos unless cascading. Both store
+// implementations must pass it.
+func testLists(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	backend, err := store.CreateList(ctx, List{Name: "Backend"})
+	if err != nil {
+		t.Fatalf("failed to create list: %v", err)
+	}
+	frontend, err := store.CreateList(ctx, List{Name: "Frontend"})
+	if err != nil {
+		t.Fatalf("failed to create list: %v", err)
+	}
+
+	renamed, err := store.UpdateList(ctx, List{ID: frontend.ID, Name: "Web"})
+	if err != nil {
+		t.Fatalf("failed to update list: %v", err)
+	}
+	got, err := store.GetList(ctx, frontend.ID)
+	if err != nil {
+		t.Fatalf("failed to get list: %v", err)
+	}
+	if !reflect.DeepEqual(got, renamed) || got.Name != "Web" || !got.CreatedAt.Equal(frontend.CreatedAt) {
+		t.Fatalf("expected list to be %v, got %v", renamed, got)
+	}
+
+	lists, err := store.GetLists(ctx)
+	if err != nil {
+		t.Fatalf("failed to get lists: %v", err)
+	}
+	if len(lists) != 2 || lists[0].ID != backend.ID || lists[1].ID != frontend.ID {
+		t.Fatalf("expected lists %d and %d, got %v", backend.ID, frontend.ID, lists)
+	}
+
+	todo, err := store.Create(ctx, Todo{Title: "API", ListID: &backend.ID, Tags: []string{"api"}})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	if todo.ListID == nil || *todo.ListID != backend.ID {
+		t.Fatalf("expected todo in list %d, got %v", backend.ID, todo.ListID)
+	}
+	if _, err := store.Create(ctx, Todo{Title: "Inbox"}); err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+
+	var unknownListErr ErrUnknownList
+	if _, err := store.Create(ctx, Todo{Title: "Lost", ListID: ptr(100)}); !errors.As(err, &unknownListErr) || unknownListErr.ID != 100 {
+		t.Fatalf("expected ErrUnknownList for list 100, got %v", err)
+	}
+	if _, _, err := store.Upsert(ctx, Todo{ID: 100, Title: "Lost", ListID: ptr(100)}, AnyRevision); !errors.As(err, &unknownListErr) {
+		t.Fatalf("expected ErrUnknownList, got %v", err)
+	}
+
+	patch := NewTodoPatch()
+	patch.ID = todo.ID
+	patch.ListID = ptr(100)
+	if _, err := store.Patch(ctx, patch, AnyRevision); !errors.As(err, &unknownListErr) {
+		t.Fatalf("expected ErrUnknownList, got %v", err)
+	}
+
+	todos, err := store.List(ctx, ListOptions{Limit: MaxListLimit, ListID: &backend.ID})
+	if err != nil {
+		t.Fatalf("failed to list todos: %v", err)
+	}
+	if len(todos) != 1 || todos[0].ID != todo.ID {
+		t.Fatalf("expected todo %d in list, got %v", todo.ID, todos)
+	}
+
+	var listNotEmptyErr ErrListNotEmpty
+	if err := store.DeleteList(ctx, backend.ID, false); !errors.As(err, &listNotEmptyErr) {
+		t.Fatalf("expected ErrListNotEmpty, got %v", err)
+	}
+
+	// A list with only todos in the trash is empty, its todos stay restorable.
+	trashed, err := store.Create(ctx, Todo{Title: "Trashed", ListID: &frontend.ID})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	if err := store.Delete(ctx, trashed.ID, AnyRevision); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+	if err := store.DeleteList(ctx, frontend.ID, false); err != nil {
+		t.Fatalf("failed to delete empty list: %v", err)
+	}
+	restored, err := store.Restore(ctx, trashed.ID, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to restore todo of the deleted list: %v", err)
+	}
+	if restored.ListID != nil || restored.Revision != 4 {
+		t.Fatalf("expected todo %d restored out of the list at revision 4, got %+v", trashed.ID, restored)
+	}
+	if err := store.DeleteList(ctx, backend.ID, true); err != nil {
+		t.Fatalf("failed to delete list: %v", err)
+	}
+
+	var listNotFoundErr ErrListNotFound
+	if _, err := store.GetList(ctx, backend.ID); !errors.As(err, &listNotFoundErr) {
+		t.Fatalf("expected ErrListNotFound, got %v", err)
+	}
+	if _, err := store.Get(ctx, todo.ID); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected todo of the deleted list to be deleted, got %v", err)
+	}
+	if _, err := store.UpdateList(ctx, List{ID: backend.ID, Name: "Gone"}); !errors.As(err, &listNotFoundErr) {
+		t.Fatalf("expected ErrListNotFound, got %v", err)
+	}
+	if err := store.DeleteList(ctx, backend.ID, true); !errors.As(err, &listNotFoundErr) {
+		t.Fatalf("expected ErrListNotFound, got %v", err)
+	}
+
+	tags, err := store.Tags(ctx)
+	if err != nil {
+		t.Fatalf("failed to get tags: %v", err)
+	}
+	if len(tags) != 0 {
+		t.Fatalf("expected no tags, got %v", tags)
+	}
+}
+
+// testSubtasks checks that a store nests todos under their parents, refuses
+// cycles and guards parents with open children. Both store implementations
+// must pass it.
+func testSubtasks(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	epic, err := store.Create(ctx, Todo{Title: "Epic"})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	step, err := store.Create(ctx, Todo{Title: "Step", ParentID: &epic.ID})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	substep, err := store.Create(ctx, Todo{Title: "Substep", ParentID: &step.ID, Completed: true})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	if _, _, err := store.Upsert(ctx, Todo{ID: 10, Title: "Other step", ParentID: &epic.ID}, NoRevision); err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+
+	descendants, err := store.Descendants(ctx, epic.ID)
+	if err != nil {
+		t.Fatalf("failed to get descendants: %v", err)
+	}
+	var ids []int
+	for _, todo := range descendants {
+		ids = append(ids, todo.ID)
+	}
+	if want := []int{step.ID, substep.ID, 10}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("expected descendants %v, got %v", want, ids)
+	}
+
+	children, err := store.List(ctx, ListOptions{Limit: MaxListLimit, ParentID: &epic.ID})
+	if err != nil {
+		t.Fatalf("failed to list todos: %v", err)
+	}
+	if len(children) != 2 || children[0].ID != step.ID || children[1].ID != 10 {
+		t.Fatalf("expected children %d and 10, got %v", step.ID, children)
+	}
+
+	var unknownParentErr ErrUnknownParent
+	if _, err := store.Create(ctx, Todo{Title: "Orphan", ParentID: ptr(100)}); !errors.As(err, &unknownParentErr) || unknownParentErr.ID != 100 {
+		t.Fatalf("expected ErrUnknownParent for todo 100, got %v", err)
+	}
+
+	var parentCycleErr ErrParentCycle
+	patch := NewTodoPatch()
+	patch.ID = epic.ID
+	patch.ParentID = &substep.ID
+	if _, err := store.Patch(ctx, patch, AnyRevision); !errors.As(err, &parentCycleErr) {
+		t.Fatalf("expected ErrParentCycle, got %v", err)
+	}
+	patch.ParentID = &epic.ID
+	if _, err := store.Patch(ctx, patch, AnyRevision); !errors.As(err, &parentCycleErr) {
+		t.Fatalf("expected ErrParentCycle, got %v", err)
+	}
+	if _, _, err := store.Upsert(ctx, Todo{ID: step.ID, Title: "Step", ParentID: &substep.ID}, AnyRevision); !errors.As(err, &parentCycleErr) {
+		t.Fatalf("expected ErrParentCycle, got %v", err)
+	}
+
+	var openChildrenErr ErrOpenChildren
+	patch = NewTodoPatch()
+	patch.ID = epic.ID
+	patch.Completed = ptr(true)
+	if _, err := store.Patch(ctx, patch, AnyRevision); !errors.As(err, &openChildrenErr) || openChildrenErr.ID != epic.ID {
+		t.Fatalf("expected ErrOpenChildren for todo %d, got %v", epic.ID, err)
+	}
+	if _, _, err := store.Upsert(ctx, Todo{ID: epic.ID, Title: "Epic", Completed: true}, AnyRevision); !errors.As(err, &openChildrenErr) {
+		t.Fatalf("expected ErrOpenChildren, got %v", err)
+	}
+
+	var hasChildrenErr ErrHasChildren
+	if err := store.Delete(ctx, step.ID, AnyRevision); !errors.As(err, &hasChildrenErr) || hasChildrenErr.ID != step.ID {
+		t.Fatalf("expected ErrHasChildren for todo %d, got %v", step.ID, err)
+	}
+
+	// Moving the other step to the top level leaves a single open child.
+	patch = NewTodoPatch()
+	patch.ID = 10
+	patch.ParentID = ptr(0)
+	moved, err := store.Patch(ctx, patch, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+	if moved.ParentID != nil {
+		t.Fatalf("expected todo at the top level, got parent %v", *moved.ParentID)
+	}
+
+	for _, id := range []int{step.ID, epic.ID} {
+		patch := NewTodoPatch()
+		patch.ID = id
+		patch.Completed = ptr(true)
+		if _, err := store.Patch(ctx, patch, AnyRevision); err != nil {
+			t.Fatalf("failed to complete todo %d: %v", id, err)
+		}
+	}
+
+	// A completed todo gets no open children, new, reopened or moved.
+	if _, err := store.Create(ctx, Todo{Title: "Late step", ParentID: &epic.ID}); !errors.As(err, &openChildrenErr) || openChildrenErr.ID != epic.ID {
+		t.Fatalf("expected ErrOpenChildren for todo %d, got %v", epic.ID, err)
+	}
+	if _, _, err := store.Upsert(ctx, Todo{ID: 11, Title: "Late step", ParentID: &epic.ID}, AnyRevision); !errors.As(err, &openChildrenErr) || openChildrenErr.ID != epic.ID {
+		t.Fatalf("expected ErrOpenChildren for todo %d, got %v", epic.ID, err)
+	}
+	patch = NewTodoPatch()
+	patch.ID = substep.ID
+	patch.Completed = ptr(false)
+	if _, err := store.Patch(ctx, patch, AnyRevision); !errors.As(err, &openChildrenErr) || openChildrenErr.ID != step.ID || openChildrenErr.ChildID != substep.ID {
+		t.Fatalf("expected ErrOpenChildren for todo %d and child %d, got %v", step.ID, substep.ID, err)
+	}
+	if _, _, err := store.Upsert(ctx, Todo{ID: substep.ID, Title: "Substep", ParentID: &step.ID}, AnyRevision); !errors.As(err, &openChildrenErr) || openChildrenErr.ID != step.ID {
+		t.Fatalf("expected ErrOpenChildren for todo %d, got %v", step.ID, err)
+	}
+	patch = NewTodoPatch()
+	patch.ID = 10
+	patch.ParentID = &epic.ID
+	if _, err := store.Patch(ctx, patch, AnyRevision); !errors.As(err, &openChildrenErr) || openChildrenErr.ID != epic.ID {
+		t.Fatalf("expected ErrOpenChildren for todo %d, got %v", epic.ID, err)
+	}
+	if got, err := store.Get(ctx, substep.ID); err != nil || !got.Completed || got.Revision != substep.Revision {
+		t.Fatalf("expected todo %d unchanged, got %+v, %v", substep.ID, got, err)
+	}
+	if _, err := store.Get(ctx, 11); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	for _, id := range []int{substep.ID, step.ID, epic.ID} {
+		if err := store.Delete(ctx, id, AnyRevision); err != nil {
+			t.Fatalf("failed to delete todo %d: %v", id, err)
+		}
+	}
+
+	list, err := store.CreateList(ctx, List{Name: "Epics"})
+	if err != nil {
+		t.Fatalf("failed to create list: %v", err)
+	}
+	parent, err := store.Create(ctx, Todo{Title: "Listed", ListID: &list.ID})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	unlisted, err := store.Create(ctx, Todo{Title: "Unlisted", ParentID: &parent.ID})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	if err := store.DeleteList(ctx, list.ID, true); !errors.As(err, &hasChildrenErr) || hasChildrenErr.ID != parent.ID {
+		t.Fatalf("expected ErrHasChildren for todo %d, got %v", parent.ID, err)
+	}
+
+	// A child in the trash does not hold the list back, it is taken out from
+	// under its purged parent and can still be restored.
+	if err := store.Delete(ctx, unlisted.ID, AnyRevision); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+	if err := store.DeleteList(ctx, list.ID, true); err != nil {
+		t.Fatalf("failed to delete list: %v", err)
+	}
+	restored, err := store.Restore(ctx, unlisted.ID, AnyRevision)
+	if err != nil {
+		t.Fatalf("failed to restore todo: %v", err)
+	}
+	if restored.ParentID != nil || restored.Revision != 4 {
+		t.Fatalf("expected todo %d restored at the top level at revision 4, got %+v", unlisted.ID, restored)
+	}
+}
+
+// testDependencies checks blocked-by dependencies, their cycle checks and the
+// order of Next. Both store implementations must pass it.
+func testDependencies(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	for _, todo := range []Todo{
+		{ID: 1, Title: "Design"},
+		{ID: 2, Title: "Build", Priority: PriorityUrgent},
+		{ID: 3, Title: "Ship", Priority: PriorityHigh},
+		{ID: 4, Title: "Docs"},
+		{ID: 5, Title: "Done", Completed: true},
+	} {
+		if _, _, err := store.Upsert(ctx, todo, NoRevision); err != nil {
+			t.Fatalf("failed to insert todo: %v", err)
+		}
+	}
+
+	// Build waits on Design, Ship on Build and Docs. Adding an edge twice is a
+	// no-op.
+	for _, dependency := range []Dependency{{2, 1}, {3, 2}, {3, 4}, {3, 4}, {4, 5}} {
+		if err := store.AddBlocker(ctx, dependency.TodoID, dependency.BlockerID); err != nil {
+			t.Fatalf("failed to add blocker %d to todo %d: %v", dependency.BlockerID, dependency.TodoID, err)
+		}
+	}
+
+	blockers, err := store.Blockers(ctx, 3)
+	if err != nil {
+		t.Fatalf("failed to get blockers: %v", err)
+	}
+	if len(blockers) != 2 || blockers[0].ID != 2 || blockers[1].ID != 4 {
+		t.Fatalf("expected blockers 2 and 4, got %v", blockers)
+	}
+
+	var dependencyCycleErr ErrDependencyCycle
+	for _, dependency := range []Dependency{{1, 3}, {1, 1}} {
+		if err := store.AddBlocker(ctx, dependency.TodoID, dependency.BlockerID); !errors.As(err, &dependencyCycleErr) {
+			t.Fatalf("expected ErrDependencyCycle for blocker %d of todo %d, got %v", dependency.BlockerID, dependency.TodoID, err)
+		}
+	}
+	if err := store.AddBlocker(ctx, 1, 100); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := store.Blockers(ctx, 100); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	for _, tt := range []struct {
+		blocked bool
+		want    []int
+	}{
+		{true, []int{2, 3}},
+		{false, []int{1, 4, 5}},
+	} {
+		todos, err := store.List(ctx, ListOptions{Limit: MaxListLimit, Blocked: &tt.blocked})
+		if err != nil {
+			t.Fatalf("failed to list todos: %v", err)
+		}
+		var ids []int
+		for _, todo := range todos {
+			ids = append(ids, todo.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Fatalf("blocked=%t: expected ids %v, got %v", tt.blocked, tt.want, ids)
+		}
+	}
+
+	// Docs is ready as early as Design, but Build outranks it once Design is
+	// done.
+	next, err := store.Next(ctx, MaxListLimit)
+	if err != nil {
+		t.Fatalf("failed to get next todos: %v", err)
+	}
+	var ids []int
+	for _, todo := range next {
+		ids = append(ids, todo.ID)
+	}
+	if want := []int{1, 2, 4, 3}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("expected next todos %v, got %v", want, ids)
+	}
+	if next, err := store.Next(ctx, 1); err != nil || len(next) != 1 || next[0].ID != 1 {
+		t.Fatalf("expected next todo 1, got %v, %v", next, err)
+	}
+
+	var openBlockersErr ErrOpenBlockers
+	patch := NewTodoPatch()
+	patch.ID = 2
+	patch.Completed = ptr(true)
+	if _, err := store.Patch(ctx, patch, AnyRevision); !errors.As(err, &openBlockersErr) || openBlockersErr.ID != 2 {
+		t.Fatalf("expected ErrOpenBlockers for todo 2, got %v", err)
+	}
+	if _, _, err := store.Upsert(ctx, Todo{ID: 2, Title: "Build", Completed: true}, AnyRevision); !errors.As(err, &openBlockersErr) {
+		t.Fatalf("expected ErrOpenBlockers, got %v", err)
+	}
+
+	var dependencyNotFoundErr ErrDependencyNotFound
+	if err := store.RemoveBlocker(ctx, 2, 1); err != nil {
+		t.Fatalf("failed to remove blocker: %v", err)
+	}
+	if err := store.RemoveBlocker(ctx, 2, 1); !errors.As(err, &dependencyNotFoundErr) {
+		t.Fatalf("expected ErrDependencyNotFound, got %v", err)
+	}
+	if _, err := store.Patch(ctx, patch, AnyRevision); err != nil {
+		t.Fatalf("failed to complete todo: %v", err)
+	}
+
+	// Deleting a blocker drops its edges, so Ship only waits on Build now.
+	if err := store.Delete(ctx, 4, AnyRevision); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+	blockers, err = store.Blockers(ctx, 3)
+	if err != nil {
+		t.Fatalf("failed to get blockers: %v", err)
+	}
+	if len(blockers) != 1 || blockers[0].ID != 2 {
+		t.Fatalf("expected blocker 2, got %v", blockers)
+	}
+	blocked := true
+	if todos, err := store.List(ctx, ListOptions{Limit: MaxListLimit, Blocked: &blocked}); err != nil || len(todos) != 0 {
+		t.Fatalf("expected no blocked todos, got %v, %v", todos, err)
+	}
+}
+
+// testBatch checks that a batch applies all its ops in order or none of them.
+// Both store implementations must pass it.
+func testBatch(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	for _, todo := range []Todo{{ID: 1, Title: "A"}, {ID: 2, Title: "B"}} {
+		if _, _, err := store.Upsert(ctx, todo, NoRevision); err != nil {
+			t.Fatalf("failed to insert todo: %v", err)
+		}
+	}
+
+	patch := NewTodoPatch()
+	patch.ID = 1
+	patch.Priority = ptr(PriorityHigh)
+	results, err := store.Batch(ctx, []BatchOp{
+		{Kind: BatchPut, Todo: Todo{ID: 3, Title: "C"}},
+		{Kind: BatchPatch, Patch: patch, Revision: 1},
+		{Kind: BatchDelete, ID: 2},
+	})
+	if err != nil {
+		t.Fatalf("failed to apply batch: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %v", results)
+	}
+	if !results[0].Created || results[0].Todo.ID != 3 {
+		t.Fatalf("expected todo 3 to be created, got %+v", results[0])
+	}
+	if results[1].Created || results[1].Todo.Priority != PriorityHigh || results[1].Todo.Revision != 2 {
+		t.Fatalf("expected todo 1 patched to revision 2, got %+v", results[1].Todo)
+	}
+	if results[2].Todo != nil {
+		t.Fatalf("expected no todo for a delete, got %+v", results[2].Todo)
+	}
+	if _, err := store.Get(ctx, 2); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// The last op fails, so neither the patch nor the put before it apply.
+	patch = NewTodoPatch()
+	patch.ID = 1
+	patch.Priority = ptr(PriorityLow)
+	_, err = store.Batch(ctx, []BatchOp{
+		{Kind: BatchPatch, Patch: patch},
+		{Kind: BatchPut, Todo: Todo{ID: 4, Title: "D"}},
+		{Kind: BatchDelete, ID: 10},
+	})
+	var batchOpErr ErrBatchOp
+	if !errors.As(err, &batchOpErr) || batchOpErr.Index != 2 || !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrBatchOp at index 2 wrapping ErrNotFound, got %v", err)
+	}
+	todo, err := store.Get(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+	if todo.Priority != PriorityHigh || todo.Revision != 2 {
+		t.Fatalf("expected todo 1 unchanged, got %+v", todo)
+	}
+	if _, err := store.Get(ctx, 4); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// Ops see the ops before them in the batch.
+	patch = NewTodoPatch()
+	patch.ID = 5
+	patch.Tags = &[]string{"batch"}
+	results, err = store.Batch(ctx, []BatchOp{
+		{Kind: BatchPut, Todo: Todo{ID: 5, Title: "E"}},
+		{Kind: BatchPatch, Patch: patch, Revision: 1},
+	})
+	if err != nil {
+		t.Fatalf("failed to apply batch: %v", err)
+	}
+	if !reflect.DeepEqual(results[1].Todo.Tags, []string{"batch"}) {
+		t.Fatalf("expected tags [batch], got %v", results[1].Todo.Tags)
+	}
+
+	created, err := store.Create(ctx, Todo{Title: "F"})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	if created.ID != 6 {
+		t.Fatalf("expected id 6, got %d", created.ID)
+	}
+}
+
+// testTrash checks that deleted todos go to the trash, out of every read and
+// write, until they are restored or purged. Both store implementations must
+// pass it.
+func testTrash(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	for _, todo := range []Todo{
+		{ID: 1, Title: "Parent", Tags: []string{"home"}},
+		{ID: 2, Title: "Child", ParentID: ptr(1)},
+		{ID: 3, Title: "Blocked"},
+	} {
+		if _, _, err := store.Upsert(ctx, todo, NoRevision); err != nil {
+			t.Fatalf("failed to insert todo: %v", err)
+		}
+	}
+	if err := store.AddBlocker(ctx, 3, 1); err != nil {
+		t.Fatalf("failed to add blocker: %v", err)
+	}
+
+	var hasChildrenErr ErrHasChildren
+	if err := store.Delete(ctx, 1, AnyRevision); !errors.As(err, &hasChildrenErr) {
+		t.Fatalf("expected ErrHasChildren, got %v", err)
+	}
+	for _, id := range []int{2, 1} {
+		if err := store.Delete(ctx, id, AnyRevision); err != nil {
+			t.Fatalf("failed to delete todo %d: %v", id, err)
+		}
+	}
+
+	if _, err := store.Get(ctx, 1); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := store.Delete(ctx, 1, AnyRevision); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	patch := NewTodoPatch()
+	patch.ID = 1
+	patch.Priority = ptr(PriorityHigh)
+	if _, err := store.Patch(ctx, patch, AnyRevision); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	var trashedErr ErrTrashed
+	if _, _, err := store.Upsert(ctx, Todo{ID: 1, Title: "Parent"}, AnyRevision); !errors.As(err, &trashedErr) || trashedErr.ID != 1 {
+		t.Fatalf("expected ErrTrashed for todo 1, got %v", err)
+	}
+	if _, err := store.Create(ctx, Todo{Title: "Orphan", ParentID: ptr(1)}); !errors.As(err, new(ErrUnknownParent)) {
+		t.Fatalf("expected ErrUnknownParent, got %v", err)
+	}
+
+	todos, err := store.List(ctx, ListOptions{Limit: MaxListLimit})
+	if err != nil {
+		t.Fatalf("failed to list todos: %v", err)
+	}
+	if len(todos) != 1 || todos[0].ID != 3 {
+		t.Fatalf("expected todo 3, got %v", todos)
+	}
+	blocked := false
+	if todos, err := store.List(ctx, ListOptions{Limit: MaxListLimit, Blocked: &blocked}); err != nil || len(todos) != 1 {
+		t.Fatalf("expected todo 3 not blocked by a todo in the trash, got %v, %v", todos, err)
+	}
+	if tags, err := store.Tags(ctx); err != nil || len(tags) != 0 {
+		t.Fatalf("expected no tags, got %v, %v", tags, err)
+	}
+
+	trash, err := store.List(ctx, ListOptions{Limit: MaxListLimit, Trashed: true})
+	if err != nil {
+		t.Fatalf("failed to list trash: %v", err)
+	}
+	if len(trash) != 2 || trash[0].ID != 1 || trash[1].ID != 2 {
+		t.Fatalf("expected todos 1 and 2 in the trash, got %v", trash)
+	}
+	if trash[0].DeletedAt == nil || trash[0].Revision != 2 {
+		t.Fatalf("expected todo 1 deleted at revision 2, got %+v", trash[0])
+	}
+
+	if _, err := store.Restore(ctx, 2, AnyRevision); !errors.As(err, &trashedErr) || trashedErr.ID != 1 {
+		t.Fatalf("expected ErrTrashed for the parent, got %v", err)
+	}
+	if _, err := store.Restore(ctx, 1, 1); !errors.As(err, new(ErrRevisionMismatch)) {
+		t.Fatalf("expected ErrRevisionMismatch, got %v", err)
+	}
+	restored, err := store.Restore(ctx, 1, 2)
+	if err != nil {
+		t.Fatalf("failed to restore todo: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.Revision != 3 || !reflect.DeepEqual(restored.Tags, []string{"home"}) {
+		t.Fatalf("expected todo 1 restored at revision 3 with its tags, got %+v", restored)
+	}
+	if _, err := store.Restore(ctx, 1, AnyRevision); !errors.As(err, new(ErrNotTrashed)) {
+		t.Fatalf("expected ErrNotTrashed, got %v", err)
+	}
+	if _, err := store.Restore(ctx, 10, AnyRevision); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if blockers, err := store.Blockers(ctx, 3); err != nil || len(blockers) != 1 {
+		t.Fatalf("expected the blocker of todo 3 back, got %v, %v", blockers, err)
+	}
+
+	// Only the todos trashed before the cutoff are purged.
+	if purged, err := store.Purge(ctx, trash[1].DeletedAt.Add(-time.Second)); err != nil || purged != 0 {
+		t.Fatalf("expected nothing purged, got %d, %v", purged, err)
+	}
+	if purged, err := store.Purge(ctx, trash[1].DeletedAt.Add(time.Second)); err != nil || purged != 1 {
+		t.Fatalf("expected 1 todo purged, got %d, %v", purged, err)
+	}
+	if _, err := store.Restore(ctx, 2, AnyRevision); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, _, err := store.Upsert(ctx, Todo{ID: 2, Title: "Child again"}, NoRevision); !errors.As(err, new(ErrPurged)) {
+		t.Fatalf("expected ErrPurged, got %v", err)
+	}
+}
+
+// testHistory checks that a store records every change of a todo, with the
+// caller and request ID in the context, and nothing for changes that fail.
+// Both store implementations must pass it.
+func testHistory(t *testing.T, store Store) {
+	ctx := context.WithValue(context.Background(), xUserHeaderKey, "alice")
+	ctx = context.WithValue(ctx, xRequestIDHeaderKey, "req-1")
+
+	created, err := store.Create(ctx, Todo{Title: "Todo"})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+
+	patch := NewTodoPatch()
+	patch.ID = created.ID
+	patch.Priority = ptr(PriorityHigh)
+	if _, err := store.Patch(ctx, patch, AnyRevision); err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+	if _, _, err := store.Upsert(ctx, Todo{ID: created.ID, Title: "Renamed", Priority: PriorityHigh}, AnyRevision); err != nil {
+		t.Fatalf("failed to upsert todo: %v", err)
+	}
+
+	// A failed batch leaves no history behind.
+	if _, err := store.Batch(ctx, []BatchOp{
+		{Kind: BatchPut, Todo: Todo{ID: created.ID, Title: "Lost"}, Revision: AnyRevision},
+		{Kind: BatchDelete, ID: 100, Revision: AnyRevision},
+	}); err == nil {
+		t.Fatalf("expected batch to fail")
+	}
+
+	if err := store.Delete(ctx, created.ID, AnyRevision); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+	if _, err := store.Restore(ctx, created.ID, AnyRevision); err != nil {
+		t.Fatalf("failed to restore todo: %v", err)
+	}
+	if err := store.Delete(ctx, created.ID, AnyRevision); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+	if _, err := store.Purge(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+
+	entries, err := store.History(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("failed to get history: %v", err)
+	}
+
+	// Fields that are null on both sides are not changes.
+	allFields := []string{"completed", "created_at", "description", "id", "priority", "tags", "title"}
+	want := []struct {
+		action   HistoryAction
+		revision int
+		changed  []string
+	}{
+		{HistoryCreate, 1, allFields},
+		{HistoryUpdate, 2, []string{"priority"}},
+		{HistoryUpdate, 3, []string{"title"}},
+		{HistoryDelete, 4, []string{"deleted_at"}},
+		{HistoryRestore, 5, []string{"deleted_at"}},
+		{HistoryDelete, 6, []string{"deleted_at"}},
+		{HistoryPurge, 6, append([]string{"deleted_at"}, allFields...)},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d history entries, got %v", len(want), entries)
+	}
+	for i, entry := range entries {
+		if entry.TodoID != created.ID || entry.Action != want[i].action || entry.Revision != want[i].revision {
+			t.Fatalf("entry %d: expected %s at revision %d, got %v", i, want[i].action, want[i].revision, entry)
+		}
+		if entry.Caller != "alice" || entry.RequestID != "req-1" {
+			t.Fatalf("entry %d: expected caller alice and request req-1, got %v", i, entry)
+		}
+		if i > 0 && entry.ID <= entries[i-1].ID {
+			t.Fatalf("entry %d: expected ids to increase, got %v", i, entries)
+		}
+
+		var changed []string
+		for name := range entry.Changes {
+			changed = append(changed, name)
+		}
+		sort.Strings(changed)
+		wantChanged := append([]string(nil), want[i].changed...)
+		sort.Strings(wantChanged)
+		if !reflect.DeepEqual(changed, wantChanged) {
+			t.Fatalf("entry %d: expected changes to %v, got %v", i, wantChanged, changed)
+		}
+	}
+
+	title := entries[2].Changes["title"]
+	if string(title.Before) != `"Todo"` || string(title.After) != `"Renamed"` {
+		t.Fatalf("expected title to change from Todo to Renamed, got %s to %s", title.Before, title.After)
+	}
+	if string(entries[6].Changes["title"].After) != "null" {
+		t.Fatalf("expected purged title to be null, got %s", entries[6].Changes["title"].After)
+	}
+
+	if _, err := store.History(ctx, 100); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	// The ID of the purged todo is not reused, its history stays its own.
+	next, err := store.Create(ctx, Todo{Title: "Next"})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	if next.ID == created.ID {
+		t.Fatalf("expected a new id, got the purged id %d", next.ID)
+	}
+	if entries, err := store.History(ctx, next.ID); err != nil || len(entries) != 1 || entries[0].Action != HistoryCreate {
+		t.Fatalf("expected only the creation in the history, got %v, %v", entries, err)
+	}
+	var purgedErr ErrPurged
+	if _, _, err := store.Upsert(ctx, Todo{ID: created.ID, Title: "Again"}, AnyRevision); !errors.As(err, &purgedErr) || purgedErr.ID != created.ID {
+		t.Fatalf("expected ErrPurged for todo %d, got %v", created.ID, err)
+	}
+	if entries, err := store.History(ctx, created.ID); err != nil || len(entries) != len(want) {
+		t.Fatalf("expected the history of the purged todo unchanged, got %v, %v", entries, err)
+	}
+}
+
+func testPatchFunc(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	if _, _, err := store.Upsert(ctx, Todo{ID: 1, Title: "A", Tags: []string{"api"}}, NoRevision); err != nil {
+		t.Fatalf("failed to insert todo: %v", err)
+	}
+
+	patched, err := store.PatchFunc(ctx, 1, 1, func(todo Todo) (TodoPatch, error) {
+		if todo.Title != "A" || !slices.Equal(todo.Tags, []string{"api"}) {
+			t.Fatalf("expected todo 1 as stored, got %+v", todo)
+		}
+		patch := NewTodoPatch()
+		patch.Title = ptr(todo.Title + "!")
+		patch.AddTags = []string{"urgent"}
+		return patch, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to patch todo: %v", err)
+	}
+	if patched.ID != 1 || patched.Title != "A!" || !slices.Equal(patched.Tags, []string{"api", "urgent"}) || patched.Revision != 2 {
+		t.Fatalf("expected todo 1 patched to revision 2, got %+v", patched)
+	}
+
+	unchanged, err := store.PatchFunc(ctx, 1, 2, func(Todo) (TodoPatch, error) { return NewTodoPatch(), nil })
+	if err != nil || unchanged.Title != "A!" || unchanged.Revision != 2 {
+		t.Fatalf("expected an empty patch to answer todo 1 unchanged, got %+v, %v", unchanged, err)
+	}
+
+	errRefused := errors.New("refused")
+	if _, err := store.PatchFunc(ctx, 1, AnyRevision, func(Todo) (TodoPatch, error) { return TodoPatch{}, errRefused }); !errors.Is(err, errRefused) {
+		t.Fatalf("expected the error of fn, got %v", err)
+	}
+
+	called := false
+	fn := func(Todo) (TodoPatch, error) {
+		called = true
+		return TodoPatch{Title: ptr("B")}, nil
+	}
+	if _, err := store.PatchFunc(ctx, 1, 1, fn); !errors.As(err, new(ErrRevisionMismatch)) {
+		t.Fatalf("expected ErrRevisionMismatch, got %v", err)
+	}
+	if _, err := store.PatchFunc(ctx, 2, AnyRevision, fn); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if called {
+		t.Fatalf("expected fn not to be called for a missing todo or another revision")
+	}
+
+	got, err := store.Get(ctx, 1)
+	if err != nil {
+		t.Fatalf("failed to get todo: %v", err)
+	}
+	if got.Title != "A!" || got.Revision != 2 {
+		t.Fatalf("expected todo 1 unchanged by the failed patches, got %+v", got)
+	}
+}
@@ -0,0 +1,84 @@
+package todos
+
+import "fmt"
+
+// TodoTree is a todo with its children, nested down to the leaves.
+type TodoTree struct {
+	Todo
+	Children []TodoTree `json:"children"`
+}
+
+// newTodoTree nests descendants, the todos below root in any order, under
+// root. Children keep the order of descendants.
+func newTodoTree(root Todo, descendants []Todo) TodoTree {
+	children := make(map[int][]Todo)
+	for _, todo := range descendants {
+		if todo.ParentID != nil {
+			children[*todo.ParentID] = append(children[*todo.ParentID], todo)
+		}
+	}
+
+	var nest func(todo Todo) TodoTree
+	nest = func(todo Todo) TodoTree {
+		tree := TodoTree{Todo: todo, Children: []TodoTree{}}
+		for _, child := range children[todo.ID] {
+			tree.Children = append(tree.Children, nest(child))
+		}
+		return tree
+	}
+	return nest(root)
+}
+
+// ErrUnknownParent is returned when a todo is written with a parent that does
+// not exist.
+type ErrUnknownParent struct {
+	ID int
+}
+
+func (e ErrUnknownParent) Error() string {
+	return fmt.Sprintf("parent todo `%d` does not exist", e.ID)
+}
+
+// ErrParentCycle is returned when nesting a todo under one of its own
+// descendants, or under itself.
+type ErrParentCycle struct {
+	ID       int
+	ParentID int
+}
+
+func (e ErrParentCycle) Error() string {
+	return fmt.Sprintf("todo `%d` cannot be nested under todo `%d`, it would become its own ancestor", e.ID, e.ParentID)
+}
+
+// ErrOpenChildren is returned when completing a todo whose children are not
+// all completed, or when making ChildID an open child of a completed todo.
+type ErrOpenChildren struct {
+	ID      int
+	ChildID int
+}
+
+func (e ErrOpenChildren) Error() string {
+	if e.ChildID != 0 {
+		return fmt.Sprintf("todo `%d` is completed, todo `%d` cannot be an open child of it, reopen it first", e.ID, e.ChildID)
+	}
+	return fmt.Sprintf("todo `%d` has open children, complete them first", e.ID)
+}
+
+// opensChild reports whether writing todo, stored as previous before or nil
+// if it is created, makes it an open child of its parent, which must not be
+// completed then.
+func opensChild(previous *Todo, todo Todo) bool {
+	if todo.Completed || todo.ParentID == nil {
+		return false
+	}
+	return previous == nil || previous.Completed || previous.ParentID == nil || *previous.ParentID != *todo.ParentID
+}
+
+// ErrHasChildren is returned when deleting a todo that still has children.
+type ErrHasChildren struct {
+	ID int
+}
+
+func (e ErrHasChildren) Error() string {
+	return fmt.Sprintf("todo `%d` has children, delete them first", e.ID)
+}
@@ -0,0 +1,254 @@
+package todos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TodoPatch is a JSON Merge Patch (RFC 7396) of a todo. The fields left out
+// of the patch are nil and left unchanged, the fields set to null reset the
+// todo field to its empty value.
+type TodoPatch struct {
+	ID          int
+	Title       *string
+	Description *string
+	Completed   *bool
+	Priority    *Priority
+	// ListID is set to 0 to remove the todo from its list.
+	ListID *int
+	// ParentID is set to 0 to make the todo a top level todo.
+	ParentID *int
+	// DueAt is set to the zero time to remove the due date.
+	DueAt *time.Time
+	// Tags replaces the tags of the todo, then AddTags and RemoveTags add and
+	// remove individual tags.
+	Tags       *[]string
+	AddTags    []string
+	RemoveTags []string
+}
+
+// todoPatchFields are the JSON fields of a TodoPatch.
+var todoPatchFields = []string{"id", "title", "description", "completed", "priority", "list_id", "parent_id", "due_at", "tags", "add_tags", "remove_tags"}
+
+func NewTodoPatch() TodoPatch {
+	return TodoPatch{}
+}
+
+// UnmarshalJSON decodes a patch, which must be a JSON object. Every member of
+// the wrong type and every member it does not know is returned in
+// ErrInvalidFields once the other members are decoded.
+//
+// A member set to null resets its field: title and description to the empty
+// string, completed to false, priority to normal, list_id, parent_id and
+// due_at to none and tags to no tags.
+func (tp *TodoPatch) UnmarshalJSON(b []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+	if members == nil {
+		return errors.New("patch is not a JSON object")
+	}
+
+	// The fields are set to their reset value before the member is decoded,
+	// as decoding null into a value leaves it unchanged.
+	var v validator
+	if raw, ok := members["id"]; ok {
+		if string(raw) == "null" {
+			v.add("id", CodeInvalid, "must not be null")
+		}
+		decodeMember(&v, "id", raw, &tp.ID)
+	}
+	if raw, ok := members["title"]; ok {
+		tp.Title = ptr("")
+		decodeMember(&v, "title", raw, tp.Title)
+	}
+	if raw, ok := members["description"]; ok {
+		tp.Description = ptr("")
+		decodeMember(&v, "description", raw, tp.Description)
+	}
+	if raw, ok := members["completed"]; ok {
+		tp.Completed = ptr(false)
+		decodeMember(&v, "completed", raw, tp.Completed)
+	}
+	if raw, ok := members["priority"]; ok {
+		tp.Priority = ptr(PriorityNormal)
+		decodeMember(&v, "priority", raw, tp.Priority)
+	}
+	if raw, ok := members["list_id"]; ok {
+		tp.ListID = ptr(0)
+		decodeMember(&v, "list_id", raw, tp.ListID)
+	}
+	if raw, ok := members["parent_id"]; ok {
+		tp.ParentID = ptr(0)
+		decodeMember(&v, "parent_id", raw, tp.ParentID)
+	}
+	if raw, ok := members["due_at"]; ok {
+		tp.DueAt = &time.Time{}
+		decodeMember(&v, "due_at", raw, tp.DueAt)
+	}
+	if raw, ok := members["tags"]; ok {
+		tp.Tags = ptr([]string{})
+		decodeMember(&v, "tags", raw, tp.Tags)
+		if *tp.Tags == nil {
+			*tp.Tags = []string{}
+		}
+	}
+	if raw, ok := members["add_tags"]; ok {
+		decodeMember(&v, "add_tags", raw, &tp.AddTags)
+	}
+	if raw, ok := members["remove_tags"]; ok {
+		decodeMember(&v, "remove_tags", raw, &tp.RemoveTags)
+	}
+
+	unknownKeys(&v, "", members, func(key string) bool { return slices.Contains(todoPatchFields, key) })
+	return v.err()
+}
+
+// decodeMember decodes the member key of a patch into dst, and records in v
+// a value dst cannot hold.
+func decodeMember(v *validator, key string, raw json.RawMessage, dst any) {
+	err := json.Unmarshal(raw, dst)
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+	case errors.As(err, &typeErr):
+		v.add(key, CodeInvalidType, fmt.Sprintf("must be of type %s, got %s", typeErr.Type, typeErr.Value))
+	default:
+		v.add(key, CodeInvalid, err.Error())
+	}
+}
+
+// empty reports whether the patch changes no field.
+func (tp TodoPatch) empty() bool {
+	return tp.Title == nil && tp.Description == nil && tp.Completed == nil && tp.Priority == nil && tp.ListID == nil && tp.ParentID == nil && tp.DueAt == nil && !tp.changesTags()
+}
+
+func (tp TodoPatch) changesTags() bool {
+	return tp.Tags != nil || len(tp.AddTags) > 0 || len(tp.RemoveTags) > 0
+}
+
+// tags returns the tags of a todo tagged with current once patched.
+func (tp TodoPatch) tags(current []string) []string {
+	tags := current
+	if tp.Tags != nil {
+		tags = *tp.Tags
+	}
+	tags = append(slices.Clone(tags), tp.AddTags...)
+
+	removed := normalizeTags(tp.RemoveTags)
+	return slices.DeleteFunc(normalizeTags(tags), func(tag string) bool {
+		_, found := slices.BinarySearch(removed, tag)
+		return found
+	})
+}
+
+// normalizeTags returns the tags trimmed, sorted and without duplicates or
+// empty tags, in a new slice.
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// Todo is a single todo. Revision, CreatedAt, UpdatedAt, CompletedAt and
+// DeletedAt are managed by the Store, the values sent by clients are ignored.
+type Todo struct {
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	Priority    Priority   `json:"priority"`
+	ListID      *int       `json:"list_id"`
+	ParentID    *int       `json:"parent_id"`
+	Revision    int        `json:"revision"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	DueAt       *time.Time `json:"due_at"`
+	Tags        []string   `json:"tags"`
+	// DeletedAt is when the todo was moved to the trash, nil if it is not in
+	// the trash.
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+// overdue reports whether todo is still open past its due date at now.
+func (todo Todo) overdue(now time.Time) bool {
+	return !todo.Completed && todo.DueAt != nil && todo.DueAt.Before(now)
+}
+
+// touch records that todo is written at now, after being stored as previous,
+// and normalizes the fields set by clients. previous is nil when todo is being
+// created.
+func (todo *Todo) touch(previous *Todo, now time.Time) {
+	if todo.Priority == "" {
+		todo.Priority = PriorityNormal
+	}
+	if todo.ListID != nil && *todo.ListID == 0 {
+		todo.ListID = nil
+	}
+	if todo.ParentID != nil && *todo.ParentID == 0 {
+		todo.ParentID = nil
+	}
+	todo.Tags = normalizeTags(todo.Tags)
+
+	if todo.DueAt != nil {
+		if todo.DueAt.IsZero() {
+			todo.DueAt = nil
+		} else {
+			todo.DueAt = ptr(storeTime(*todo.DueAt))
+		}
+	}
+
+	todo.CreatedAt = now
+	todo.UpdatedAt = now
+	todo.CompletedAt = nil
+	todo.DeletedAt = nil
+	if previous != nil {
+		todo.CreatedAt = previous.CreatedAt
+		todo.CompletedAt = previous.CompletedAt
+	}
+
+	switch {
+	case !todo.Completed:
+		todo.CompletedAt = nil
+	case todo.CompletedAt == nil:
+		todo.CompletedAt = &now
+	}
+}
+
+type ErrNotFound struct {
+	ID int
+}
+
+func (e ErrNotFound) Error() string {
+	return fmt.Sprintf("todo `%d` not found", e.ID)
+}
+
+type ErrAlreadyExists struct {
+	ID int
+}
+
+func (e ErrAlreadyExists) Error() string {
+	return fmt.Sprintf("todo `%d` already exists", e.ID)
+}
+
+type ErrRevisionMismatch struct {
+	ID       int
+	Revision int
+}
+
+func (e ErrRevisionMismatch) Error() string {
+	return fmt.Sprintf("todo `%d` is at revision `%d`", e.ID, e.Revision)
+}
+
+var ErrNoFieldsToUpdate = errors.New("no fields to update")
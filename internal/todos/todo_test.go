@@ -0,0 +1,103 @@
+package todos
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTodoPatchUnmarshalJSON(t *testing.T) {
+	t.Parallel()
+
+	due := time.Date(2024, 11, 1, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		body string
+		want TodoPatch
+	}{
+		{"empty", `{}`, TodoPatch{}},
+		{"id", `{"id": 1}`, TodoPatch{ID: 1}},
+		{"title", `{"title": "new title"}`, TodoPatch{Title: ptr("new title")}},
+		{"title null", `{"title": null}`, TodoPatch{Title: ptr("")}},
+		{"description", `{"description": "details"}`, TodoPatch{Description: ptr("details")}},
+		{"description null", `{"description": null}`, TodoPatch{Description: ptr("")}},
+		{"completed", `{"completed": true}`, TodoPatch{Completed: ptr(true)}},
+		{"completed false", `{"completed": false}`, TodoPatch{Completed: ptr(false)}},
+		{"completed null", `{"completed": null}`, TodoPatch{Completed: ptr(false)}},
+		{"priority", `{"priority": "urgent"}`, TodoPatch{Priority: ptr(PriorityUrgent)}},
+		{"priority null", `{"priority": null}`, TodoPatch{Priority: ptr(PriorityNormal)}},
+		{"list_id", `{"list_id": 2}`, TodoPatch{ListID: ptr(2)}},
+		{"list_id null", `{"list_id": null}`, TodoPatch{ListID: ptr(0)}},
+		{"parent_id", `{"parent_id": 3}`, TodoPatch{ParentID: ptr(3)}},
+		{"parent_id null", `{"parent_id": null}`, TodoPatch{ParentID: ptr(0)}},
+		{"due_at", `{"due_at": "2024-11-01T09:30:00Z"}`, TodoPatch{DueAt: &due}},
+		{"due_at null", `{"due_at": null}`, TodoPatch{DueAt: &time.Time{}}},
+		{"tags", `{"tags": ["api", "backend"]}`, TodoPatch{Tags: &[]string{"api", "backend"}}},
+		{"tags null", `{"tags": null}`, TodoPatch{Tags: &[]string{}}},
+		{"add_tags", `{"add_tags": ["api"]}`, TodoPatch{AddTags: []string{"api"}}},
+		{"remove_tags", `{"remove_tags": ["api"]}`, TodoPatch{RemoveTags: []string{"api"}}},
+		{"every field", `{"id": 1, "title": "t", "description": "d", "completed": true, "priority": "low", "list_id": 2, "parent_id": 3, "due_at": "2024-11-01T09:30:00Z", "tags": ["a"], "add_tags": ["b"], "remove_tags": ["c"]}`,
+			TodoPatch{ID: 1, Title: ptr("t"), Description: ptr("d"), Completed: ptr(true), Priority: ptr(PriorityLow), ListID: ptr(2), ParentID: ptr(3), DueAt: &due, Tags: &[]string{"a"}, AddTags: []string{"b"}, RemoveTags: []string{"c"}}},
+	}
+	for _, tt := range tests {
+		patch := NewTodoPatch()
+		if err := json.Unmarshal([]byte(tt.body), &patch); err != nil {
+			t.Fatalf("%s: failed to unmarshal patch: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(patch, tt.want) {
+			t.Fatalf("%s: expected patch %+v, got %+v", tt.name, tt.want, patch)
+		}
+	}
+}
+
+func TestTodoPatchUnmarshalJSONInvalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		body     string
+		pointers []string
+	}{
+		{"id null", `{"id": null}`, []string{"#/id"}},
+		{"id string", `{"id": "1"}`, []string{"#/id"}},
+		{"title number", `{"title": 1}`, []string{"#/title"}},
+		{"description bool", `{"description": true}`, []string{"#/description"}},
+		{"completed string", `{"completed": "yes"}`, []string{"#/completed"}},
+		{"priority unknown", `{"priority": "asap"}`, []string{"#/priority"}},
+		{"priority number", `{"priority": 3}`, []string{"#/priority"}},
+		{"list_id string", `{"list_id": "2"}`, []string{"#/list_id"}},
+		{"parent_id float", `{"parent_id": 1.5}`, []string{"#/parent_id"}},
+		{"due_at not RFC 3339", `{"due_at": "tomorrow"}`, []string{"#/due_at"}},
+		{"tags string", `{"tags": "api"}`, []string{"#/tags"}},
+		{"add_tags numbers", `{"add_tags": [1]}`, []string{"#/add_tags"}},
+		{"remove_tags object", `{"remove_tags": {}}`, []string{"#/remove_tags"}},
+		{"unknown fields", `{"done": true, "completed": true, "Title": "t"}`, []string{"#/Title", "#/done"}},
+		{"every error", `{"title": 1, "completed": "yes", "done": true}`, []string{"#/title", "#/completed", "#/done"}},
+	}
+	for _, tt := range tests {
+		patch := NewTodoPatch()
+		err := json.Unmarshal([]byte(tt.body), &patch)
+
+		var fieldsErr ErrInvalidFields
+		if !errors.As(err, &fieldsErr) {
+			t.Fatalf("%s: expected ErrInvalidFields, got %v", tt.name, err)
+		}
+		var pointers []string
+		for _, field := range fieldsErr.Fields {
+			pointers = append(pointers, field.Pointer)
+		}
+		if !slices.Equal(pointers, tt.pointers) {
+			t.Fatalf("%s: expected errors at %v, got %+v", tt.name, tt.pointers, fieldsErr.Fields)
+		}
+	}
+
+	for _, body := range []string{`null`, `[]`, `"title"`, `{"title": "t"`} {
+		patch := NewTodoPatch()
+		if err := json.Unmarshal([]byte(body), &patch); err == nil || errors.As(err, new(ErrInvalidFields)) {
+			t.Fatalf("%s: expected the patch to be rejected as a whole, got %v", body, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package todos
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	// DefaultPurgeInterval is how often a Purger purges the trash when its
+	// config sets no interval.
+	DefaultPurgeInterval = time.Hour
+	// DefaultTrashRetention is how long todos stay in the trash when the
+	// config of a Purger sets no retention.
+	DefaultTrashRetention = 30 * 24 * time.Hour
+)
+
+// ErrTrashed is returned when writing a todo that is in the trash, or
+// restoring a todo whose parent is.
+type ErrTrashed struct {
+	ID int
+}
+
+func (e ErrTrashed) Error() string {
+	return fmt.Sprintf("todo `%d` is in the trash, restore it first", e.ID)
+}
+
+// ErrNotTrashed is returned when restoring a todo that is not in the trash.
+type ErrNotTrashed struct {
+	ID int
+}
+
+func (e ErrNotTrashed) Error() string {
+	return fmt.Sprintf("todo `%d` is not in the trash", e.ID)
+}
+
+// ErrPurged is returned when creating a todo with the id of a purged todo, so
+// that the history of the purged todo is not continued by another one.
+type ErrPurged struct {
+	ID int
+}
+
+func (e ErrPurged) Error() string {
+	return fmt.Sprintf("todo `%d` was purged, its id cannot be reused", e.ID)
+}
+
+// PurgerConfig configures a Purger.
+type PurgerConfig struct {
+	Store     Store
+	Slog      *slog.Logger
+	Interval  time.Duration
+	Retention time.Duration
+}
+
+// Purger permanently deletes the todos that have been in the trash for longer
+// than its retention.
+type Purger struct {
+	now       func() time.Time
+	store     Store
+	slog      *slog.Logger
+	interval  time.Duration
+	retention time.Duration
+}
+
+func NewPurger(c *PurgerConfig) *Purger {
+	p := &Purger{
+		now:       time.Now,
+		store:     c.Store,
+		slog:      c.Slog,
+		interval:  c.Interval,
+		retention: c.Retention,
+	}
+	if p.interval <= 0 {
+		p.interval = DefaultPurgeInterval
+	}
+	if p.retention <= 0 {
+		p.retention = DefaultTrashRetention
+	}
+	return p
+}
+
+// Run purges the trash every interval until ctx is done.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.purge(ctx); err != nil {
+			p.slog.Error("failed to purge the trash", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Purger) purge(ctx context.Context) error {
+	ctx = context.WithValue(ctx, xUserHeaderKey, "purger")
+	purged, err := p.store.Purge(ctx, storeTime(p.now()).Add(-p.retention))
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		p.slog.Info("purged the trash", "todos", purged)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package todos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestPurgerPurgesAfterRetention(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	store := NewMemoryStore()
+	store.now = testTime
+	todo, err := store.Create(ctx, Todo{Title: "Trashed"})
+	if err != nil {
+		t.Fatalf("failed to create todo: %v", err)
+	}
+	if err := store.Delete(ctx, todo.ID, AnyRevision); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+
+	purger := NewPurger(&PurgerConfig{
+		Store:     store,
+		Slog:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Retention: time.Hour,
+	})
+
+	purger.now = func() time.Time { return testTime().Add(time.Hour) }
+	if err := purger.purge(ctx); err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+	if _, err := store.Restore(ctx, todo.ID, AnyRevision); err != nil {
+		t.Fatalf("expected todo kept for the retention, got %v", err)
+	}
+	if err := store.Delete(ctx, todo.ID, AnyRevision); err != nil {
+		t.Fatalf("failed to delete todo: %v", err)
+	}
+
+	purger.now = func() time.Time { return testTime().Add(time.Hour + time.Microsecond) }
+	if err := purger.purge(ctx); err != nil {
+		t.Fatalf("failed to purge: %v", err)
+	}
+	if _, err := store.Restore(ctx, todo.ID, AnyRevision); !errors.As(err, new(ErrNotFound)) {
+		t.Fatalf("expected ErrNotFound after the retention, got %v", err)
+	}
+}
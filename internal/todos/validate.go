@@ -0,0 +1,270 @@
+package todos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// MaxBodyBytes is the size of the largest request body accepted, larger
+	// bodies answer 413.
+	MaxBodyBytes = 1 << 20
+
+	// The limits of the fields of todos and lists, in characters.
+	MaxTitleLength       = 200
+	MaxDescriptionLength = 10_000
+	MaxTagLength         = 50
+	MaxListNameLength    = 100
+	// MaxTags is the number of tags a todo can have.
+	MaxTags = 50
+)
+
+// validator collects every invalid field of a request body, so that they are
+// all answered at once.
+type validator struct {
+	fields []FieldError
+}
+
+// add records that field, a JSON name or path like `ops/1/title`, is invalid.
+// Only the first error of a field is recorded, so that a field of the wrong
+// type is not also answered as empty.
+func (v *validator) add(field string, code ErrorCode, detail string) {
+	pointer := "#/" + field
+	if slices.ContainsFunc(v.fields, func(f FieldError) bool { return f.Pointer == pointer }) {
+		return
+	}
+	v.fields = append(v.fields, FieldError{Pointer: pointer, Code: code, Detail: detail})
+}
+
+// err returns ErrInvalidFields with the invalid fields, or nil if there are
+// none.
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return ErrInvalidFields{Fields: v.fields}
+}
+
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, CodeRequired, "must not be empty")
+	}
+}
+
+func (v *validator) maxLength(field, value string, limit int) {
+	if n := utf8.RuneCountInString(value); n > limit {
+		v.add(field, CodeTooLong, fmt.Sprintf("is %d characters long, use at most %d", n, limit))
+	}
+}
+
+func (v *validator) notNegative(field string, value int) {
+	if value < 0 {
+		v.add(field, CodeInvalid, fmt.Sprintf("must not be negative, got `%d`", value))
+	}
+}
+
+func (v *validator) tags(field string, tags []string) {
+	if len(tags) > MaxTags {
+		v.add(field, CodeTooMany, fmt.Sprintf("has %d tags, use at most %d", len(tags), MaxTags))
+	}
+	for i, tag := range tags {
+		v.maxLength(fmt.Sprintf("%s/%d", field, i), tag, MaxTagLength)
+	}
+}
+
+// validateTodo checks a todo to be written, found at prefix in the body. Its
+// id is checked against the path or batch operation by the caller.
+func validateTodo(v *validator, prefix string, todo Todo) {
+	v.required(prefix+"title", todo.Title)
+	v.maxLength(prefix+"title", todo.Title, MaxTitleLength)
+	v.maxLength(prefix+"description", todo.Description, MaxDescriptionLength)
+	if todo.ListID != nil {
+		v.notNegative(prefix+"list_id", *todo.ListID)
+	}
+	if todo.ParentID != nil {
+		v.notNegative(prefix+"parent_id", *todo.ParentID)
+	}
+	v.tags(prefix+"tags", todo.Tags)
+}
+
+// validateTodoPatch checks the fields a patch, found at prefix in the body,
+// changes.
+func validateTodoPatch(v *validator, prefix string, patch TodoPatch) {
+	if patch.Title != nil {
+		v.required(prefix+"title", *patch.Title)
+		v.maxLength(prefix+"title", *patch.Title, MaxTitleLength)
+	}
+	if patch.Description != nil {
+		v.maxLength(prefix+"description", *patch.Description, MaxDescriptionLength)
+	}
+	if patch.ListID != nil {
+		v.notNegative(prefix+"list_id", *patch.ListID)
+	}
+	if patch.ParentID != nil {
+		v.notNegative(prefix+"parent_id", *patch.ParentID)
+	}
+	if patch.Tags != nil {
+		v.tags(prefix+"tags", *patch.Tags)
+	}
+	v.tags(prefix+"add_tags", patch.AddTags)
+	v.tags(prefix+"remove_tags", patch.RemoveTags)
+}
+
+func validateList(v *validator, list List) {
+	v.required("name", list.Name)
+	v.maxLength("name", list.Name, MaxListNameLength)
+}
+
+// decodeBody decodes the JSON body of r, named name in errors, into dst. The
+// body must be a single JSON value of at most MaxBodyBytes. The invalid and
+// unknown fields of the body are recorded in v, as decodeObject does.
+func decodeBody(w http.ResponseWriter, r *http.Request, v *validator, name string, dst any) error {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	if err != nil {
+		return err
+	}
+
+	if err := decodeObject(v, "", body, dst); err != nil {
+		return fmt.Errorf("failed to decode %s body: %w", name, err)
+	}
+	return nil
+}
+
+// decodeObject decodes the JSON value raw, found at prefix in the body, into
+// dst. The members of an object dst cannot hold, like a number for a string
+// or an unknown priority, are recorded in v along with the members dst has no
+// field for, so that they are answered along with the fields that fail
+// validation. An error is only returned if raw cannot be decoded at all.
+func decodeObject(v *validator, prefix string, raw []byte, dst any) error {
+	err := json.Unmarshal(raw, dst)
+	var fieldsErr ErrInvalidFields
+	switch {
+	case err == nil:
+	case errors.As(err, &fieldsErr):
+		for _, field := range fieldsErr.Fields {
+			v.add(prefix+strings.TrimPrefix(field.Pointer, "#/"), field.Code, field.Detail)
+		}
+	case !decodeMembers(v, prefix, raw, dst):
+		return err
+	}
+
+	unknownFields(v, prefix, raw, dst)
+	return nil
+}
+
+// decodeMembers decodes the members of the JSON object raw, found at prefix in
+// the body, into the fields of the struct dst one by one, and records in v the
+// members that fail. It reports false if raw is no object or dst no struct.
+// Types that decode themselves check their own members.
+func decodeMembers(v *validator, prefix string, raw []byte, dst any) bool {
+	if _, ok := dst.(json.Unmarshaler); ok {
+		return false
+	}
+	value := reflect.ValueOf(dst)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return false
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &members); err != nil || members == nil {
+		return false
+	}
+
+	keys := make([]string, 0, len(members))
+	for key := range members {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	value = value.Elem()
+	for i := range value.NumField() {
+		name, ok := jsonField(value.Type().Field(i))
+		if !ok {
+			continue
+		}
+		// Like encoding/json, keys match fields regardless of case.
+		j := slices.IndexFunc(keys, func(key string) bool { return key == name })
+		if j < 0 {
+			j = slices.IndexFunc(keys, func(key string) bool { return strings.EqualFold(key, name) })
+		}
+		if j >= 0 {
+			decodeMember(v, prefix+keys[j], members[keys[j]], value.Field(i).Addr().Interface())
+		}
+	}
+	return true
+}
+
+// unknownFields records the fields of the JSON object raw, found at prefix in
+// the body, that the struct dst has no field for. Types that decode
+// themselves check their own fields.
+func unknownFields(v *validator, prefix string, raw []byte, dst any) {
+	if _, ok := dst.(json.Unmarshaler); ok {
+		return
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return
+	}
+
+	// Like encoding/json, keys match fields regardless of case.
+	fields := jsonFields(reflect.TypeOf(dst))
+	unknownKeys(v, prefix, object, func(key string) bool {
+		return slices.ContainsFunc(fields, func(field string) bool { return strings.EqualFold(field, key) })
+	})
+}
+
+// unknownKeys records the keys of object, found at prefix in the body, that
+// are not known.
+func unknownKeys[V any](v *validator, prefix string, object map[string]V, known func(key string) bool) {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		if !known(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.add(prefix+key, CodeUnknownField, fmt.Sprintf("unknown field `%s`", key))
+	}
+}
+
+// jsonFields returns the JSON names of the fields of the struct t, or of the
+// struct t points to.
+func jsonFields(t reflect.Type) []string {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var fields []string
+	for i := range t.NumField() {
+		if name, ok := jsonField(t.Field(i)); ok {
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// jsonField returns the JSON name of field, or false if it is not encoded.
+func jsonField(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	switch name {
+	case "-":
+		return "", false
+	case "":
+		return field.Name, true
+	default:
+		return name, true
+	}
+}
@@ -37,14 +37,33 @@ check_json() {
 response=$(curl -s -o /dev/null -w "%{http_code}" -X PUT $BASE_URL/todos/1 \
      -H "Content-Type: application/json" \
      -d '{"id": 1, "title": "First Todo", "description": "This is the first todo", "completed": false}')
-check_status $response 200
+check_status $response 201
 
 # Create or Update Todo with ID 2
 response=$(curl -s -o /dev/null -w "%{http_code}" -X PUT $BASE_URL/todos/2 \
      -H "Content-Type: application/json" \
      -d '{"id": 2, "title": "Second Todo", "description": "This is the second todo", "completed": false}')
+check_status $response 201
+
+# Create a Todo and let the server assign its ID
+response=$(curl -s -w "%{http_code}" -o todo.json -X POST $BASE_URL/todos \
+     -H "Content-Type: application/json" \
+     -d '{"title": "Third Todo", "description": "This is the third todo", "completed": false}')
+check_status ${response: -3} 201
+id=$(jq -r '.id' todo.json)
+check_json "$id" "3"
+
+# Delete Todo with ID 3
+response=$(curl -s -o /dev/null -w "%{http_code}" -X DELETE $BASE_URL/todos/3)
 check_status $response 200
 
+# Refuse to overwrite Todo with ID 1
+response=$(curl -s -o /dev/null -w "%{http_code}" -X PUT $BASE_URL/todos/1 \
+     -H "Content-Type: application/json" \
+     -H "If-None-Match: *" \
+     -d '{"id": 1, "title": "Overwritten Todo", "description": "This is not the first todo", "completed": false}')
+check_status $response 412
+
 # Get All Todos
 response=$(curl -s -w "%{http_code}" -o todos.json -X GET $BASE_URL/todos)
 check_status ${response: -3} 200
@@ -85,11 +104,42 @@ response=$(curl -s -o /dev/null -w "%{http_code}" -X PATCH $BASE_URL/todos/2 \
      -d '{"id": 2,"description": null}')
 check_status $response 200
 
+# Merge patch Todo with ID 2 to reopen it
+response=$(curl -s -w "%{http_code}" -o todo.json -X PATCH $BASE_URL/todos/2 \
+     -H "Content-Type: application/merge-patch+json" \
+     -d '{"completed": false}')
+check_status ${response: -3} 200
+completed=$(jq -r '.completed' todo.json)
+check_json "$completed" "false"
+
+# JSON patch Todo with ID 2 to rename it, only if its title is unchanged
+response=$(curl -s -w "%{http_code}" -o todo.json -X PATCH $BASE_URL/todos/2 \
+     -H "Content-Type: application/json-patch+json" \
+     -d '[{"op": "test", "path": "/title", "value": "Second Todo"}, {"op": "replace", "path": "/title", "value": "Second Todo renamed"}]')
+check_status ${response: -3} 200
+title=$(jq -r '.title' todo.json)
+check_json "$title" "Second Todo renamed"
+
+# The same JSON patch fails its test now
+response=$(curl -s -o /dev/null -w "%{http_code}" -X PATCH $BASE_URL/todos/2 \
+     -H "Content-Type: application/json-patch+json" \
+     -d '[{"op": "test", "path": "/title", "value": "Second Todo"}, {"op": "replace", "path": "/title", "value": "Second Todo renamed"}]')
+check_status $response 409
+
 # Get Todo with ID 2 to verify description is an empty string
 response=$(curl -s -w "%{http_code}" -o todo.json -X GET $BASE_URL/todos/2)
 check_status ${response: -3} 200
 description=$(jq -r '.description' todo.json)
 check_json "$description" ""
 
+# Get Todo with ID 2 as a checklist item
+response=$(curl -s -w "%{http_code}" -o todo.txt -X GET $BASE_URL/todos/2 -H "Accept: text/plain")
+check_status ${response: -3} 200
+check_json "$(cat todo.txt)" "- [ ] Second Todo renamed"
+
+# Formats that are not offered answer 406
+response=$(curl -s -o /dev/null -w "%{http_code}" -X GET $BASE_URL/todos -H "Accept: text/html")
+check_status $response 406
+
 echo "All tests passed!"
-rm todos.json todo.json
+rm todos.json todo.json todo.txt